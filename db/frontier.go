@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Recrawl scheduling limits for the crawl frontier.
+const (
+	DefaultRecrawlInterval = 24 * time.Hour      // Interval used after the first successful crawl of a page
+	MinRecrawlInterval     = time.Hour           // Pages that change all the time are not crawled more often than this
+	MaxRecrawlInterval     = 30 * 24 * time.Hour // Pages that never change are still crawled at least this often
+	RetryBaseDelay         = 15 * time.Minute    // Delay before the first retry of a failed url
+	MaxRetryDelay          = 7 * 24 * time.Hour  // Failed urls are retried at least this often
+	CrawlLease             = time.Hour           // How long a url handed to a crawl run is hidden from other runs
+)
+
+// lastModBatchSize is the number of urls scheduled per statement by ScheduleModified, two parameters per url.
+const lastModBatchSize = 5000
+
+// ScheduleSuccess is a method on the CrawledUrl struct that schedules the next crawl after a successful crawl.
+// The recrawl interval adapts to how often the page changes: it is halved when the content changed since the last crawl
+// and grows by half when it did not, staying between MinRecrawlInterval and MaxRecrawlInterval.
+// The first successful crawl starts from DefaultRecrawlInterval. The failure count is reset.
+//
+// Parameters:
+// now time.Time: The time of the crawl.
+// changed bool: Whether the page content changed since the last crawl.
+//
+// This method does not return any values.
+func (crawled *CrawledUrl) ScheduleSuccess(now time.Time, changed bool) {
+	interval := crawled.RecrawlInterval
+	switch {
+	case interval == 0:
+		interval = DefaultRecrawlInterval
+	case changed:
+		interval = interval / 2
+	default:
+		interval = interval + interval/2
+	}
+	interval = min(max(interval, MinRecrawlInterval), MaxRecrawlInterval)
+	next := now.Add(interval)
+	crawled.RecrawlInterval = interval
+	crawled.NextCrawlAt = &next
+	crawled.FailCount = 0
+}
+
+// ScheduleFailure is a method on the CrawledUrl struct that schedules a retry after a failed crawl.
+// Retries back off exponentially, starting at RetryBaseDelay and doubling with every consecutive failure up to MaxRetryDelay.
+// The recrawl interval is left untouched so it still applies once the url recovers.
+//
+// Parameters:
+// now time.Time: The time of the crawl.
+//
+// This method does not return any values.
+func (crawled *CrawledUrl) ScheduleFailure(now time.Time) {
+	crawled.FailCount++
+	delay := MaxRetryDelay
+	// Avoid overflowing the shift for urls that have failed many times
+	if crawled.FailCount < 20 {
+		delay = min(RetryBaseDelay<<(crawled.FailCount-1), MaxRetryDelay)
+	}
+	next := now.Add(delay)
+	crawled.NextCrawlAt = &next
+}
+
+// ScheduleModified is a method on the CrawledUrl struct that schedules the stored urls that changed since their last crawl to be crawled now.
+// A url is scheduled when its last modification time, usually taken from a sitemap, is after its last crawl and it is not already due.
+// Urls that were never crawled or are not stored are left alone.
+//
+// Parameters:
+// lastMods map[string]time.Time: The last modification time of every url.
+// now time.Time: The time the urls become due.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the method's execution.
+func (crawled *CrawledUrl) ScheduleModified(lastMods map[string]time.Time, now time.Time) error {
+	urls := make([]string, 0, len(lastMods))
+	for url := range lastMods {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for start := 0; start < len(urls); start += lastModBatchSize {
+		batch := urls[start:min(start+lastModBatchSize, len(urls))]
+		args := make([]interface{}, 0, len(batch)*2+2)
+		args = append(args, now)
+		for _, url := range batch {
+			args = append(args, url, lastMods[url])
+		}
+		args = append(args, now)
+		rows := strings.TrimSuffix(strings.Repeat("(?::text, ?::timestamptz),", len(batch)), ",")
+		err := DBConn.Exec(`UPDATE crawled_urls AS c SET next_crawl_at = ?
+			FROM (VALUES `+rows+`) AS v (url, last_mod)
+			WHERE c.url = v.url AND c.deleted_at IS NULL AND c.last_tested < v.last_mod
+			AND c.next_crawl_at > ?`, args...).Error
+		if err != nil {
+			fmt.Print(err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleSuccess(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Define test cases
+	testCases := []struct {
+		interval time.Duration
+		changed  bool
+		expected time.Duration
+	}{
+		{0, false, DefaultRecrawlInterval},
+		{0, true, DefaultRecrawlInterval},
+		{24 * time.Hour, true, 12 * time.Hour},
+		{24 * time.Hour, false, 36 * time.Hour},
+		{MinRecrawlInterval, true, MinRecrawlInterval},
+		{MaxRecrawlInterval, false, MaxRecrawlInterval},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		crawled := &CrawledUrl{RecrawlInterval: tc.interval, FailCount: 3}
+		crawled.ScheduleSuccess(now, tc.changed)
+
+		// Compare the result with the expected value
+		if crawled.RecrawlInterval != tc.expected {
+			t.Errorf("For interval '%v' and changed '%v', expected '%v', but got '%v'", tc.interval, tc.changed, tc.expected, crawled.RecrawlInterval)
+		}
+		if !crawled.NextCrawlAt.Equal(now.Add(tc.expected)) {
+			t.Errorf("Expected next crawl at '%v', but got '%v'", now.Add(tc.expected), crawled.NextCrawlAt)
+		}
+		if crawled.FailCount != 0 {
+			t.Errorf("Expected fail count to be reset, but got '%d'", crawled.FailCount)
+		}
+	}
+}
+
+func TestScheduleFailure(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	crawled := &CrawledUrl{RecrawlInterval: 48 * time.Hour}
+
+	expected := []time.Duration{RetryBaseDelay, 2 * RetryBaseDelay, 4 * RetryBaseDelay, 8 * RetryBaseDelay}
+	for i, delay := range expected {
+		crawled.ScheduleFailure(now)
+
+		// Compare the retry time with the expected value
+		if !crawled.NextCrawlAt.Equal(now.Add(delay)) {
+			t.Errorf("After %d failures, expected next crawl at '%v', but got '%v'", i+1, now.Add(delay), crawled.NextCrawlAt)
+		}
+	}
+
+	// The backoff is capped
+	for i := 0; i < 100; i++ {
+		crawled.ScheduleFailure(now)
+	}
+	if !crawled.NextCrawlAt.Equal(now.Add(MaxRetryDelay)) {
+		t.Errorf("Expected next crawl at '%v', but got '%v'", now.Add(MaxRetryDelay), crawled.NextCrawlAt)
+	}
+
+	// The recrawl interval is kept for when the url recovers
+	if crawled.RecrawlInterval != 48*time.Hour {
+		t.Errorf("Expected recrawl interval '%v', but got '%v'", 48*time.Hour, crawled.RecrawlInterval)
+	}
+}
@@ -14,8 +14,12 @@ var DBConn *gorm.DB // DBConn is a global variable that holds the database conne
 // It retrieves the database URL from the environment variables and attempts to connect to the database.
 // If the connection fails, it prints an error message and panics.
 // It then enables the "uuid-ossp" extension in the database. If this fails, it prints an error message and panics.
-// Finally, it attempts to auto-migrate the User, SearchSettings, CrawledUrl, and SearchIndex tables.
+// It then sets up the Posting model as the token_urls join table. If this fails, it prints an error message and panics.
+// Before the token values are made unique, any duplicate tokens are merged and the old non-unique index is dropped. If this fails, it prints an error message and panics.
+// It then attempts to auto-migrate the User, SearchSettings, CrawledUrl, and SearchIndex tables.
 // If the migration fails, it prints an error message and panics.
+// If the migration added token positions to the token_urls table, every indexed URL is marked as not indexed so it is indexed again with positions.
+// Finally, it fills in the host of any crawled URL that was saved without one. If this fails, it prints an error message and panics.
 //
 // This function does not take any parameters and does not return any values.
 func InitDB() {
@@ -34,11 +38,53 @@ func InitDB() {
 		panic(err)
 	}
 
-	err = DBConn.AutoMigrate(&User{}, &SearchSettings{}, &CrawledUrl{}, &SearchIndex{})
+	// Store the token_urls join table with the Posting model so it can hold term frequencies
+	err = DBConn.SetupJoinTable(&SearchIndex{}, "Urls", &Posting{})
+	if err != nil {
+		fmt.Println("Failed to set up the token_urls join table")
+		panic(err)
+	}
+
+	// Token values are upserted in bulk, which needs them to be unique. Merge any duplicates before the unique index is created
+	if DBConn.Migrator().HasTable(&SearchIndex{}) && !DBConn.Migrator().HasIndex(&SearchIndex{}, "idx_search_index_values") {
+		err = DBConn.Transaction(mergeDuplicateTokens)
+		if err != nil {
+			fmt.Println("Failed to merge duplicate tokens")
+			panic(err)
+		}
+		if DBConn.Migrator().HasIndex(&SearchIndex{}, "idx_search_index_value") {
+			err = DBConn.Migrator().DropIndex(&SearchIndex{}, "idx_search_index_value")
+			if err != nil {
+				fmt.Println("Failed to drop the old token index")
+				panic(err)
+			}
+		}
+	}
+
+	// Postings saved before token positions were recorded cannot answer phrase queries
+	missingPositions := DBConn.Migrator().HasTable(&Posting{}) && !DBConn.Migrator().HasColumn(&Posting{}, "TitlePositions")
+
+	err = DBConn.AutoMigrate(&User{}, &SearchSettings{}, &CrawledUrl{}, &SearchIndex{}, &SearchQuery{})
 	if err != nil {
 		fmt.Println("Failed to migrate")
 		panic(err)
 	}
+
+	// Index those urls again so their postings get positions
+	if missingPositions {
+		err = DBConn.Model(&CrawledUrl{}).Where("indexed = ?", true).Update("indexed", false).Error
+		if err != nil {
+			fmt.Println("Failed to queue urls for reindexing")
+			panic(err)
+		}
+	}
+
+	// Fill in the host of urls saved before hosts were recorded
+	err = DBConn.Exec("UPDATE crawled_urls SET host = lower(substring(url from '://([^/?#]+)')) WHERE host IS NULL OR host = ''").Error
+	if err != nil {
+		fmt.Println("Failed to backfill url hosts")
+		panic(err)
+	}
 }
 
 // GetDB is a function that returns the current database connection.
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Positions lists the positions of a token within a field, in ascending order. It is stored as a Postgres integer array.
+type Positions []int
+
+// Scan is a method on the Positions type that reads a Postgres integer array such as {1,4,9}.
+// A NULL array is read as no positions.
+//
+// Parameters:
+// src interface{}: The value read from the database.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the method's execution.
+func (p *Positions) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Positions", src)
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "{"), "}")
+	if text == "" {
+		*p = Positions{}
+		return nil
+	}
+	parts := strings.Split(text, ",")
+	positions := make(Positions, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return fmt.Errorf("invalid position %q: %w", part, err)
+		}
+		positions[i] = n
+	}
+	*p = positions
+	return nil
+}
+
+// Value is a method on the Positions type that writes the positions as a Postgres integer array literal.
+//
+// This method does not take any parameters.
+//
+// Returns:
+// driver.Value: The array literal, {} when there are no positions.
+// error: Always nil.
+func (p Positions) Value() (driver.Value, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range p {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(n))
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
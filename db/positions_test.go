@@ -0,0 +1,72 @@
+package db
+
+import "testing"
+
+func TestPositionsValue(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		positions Positions
+		expected  string
+	}{
+		{nil, "{}"},
+		{Positions{}, "{}"},
+		{Positions{3}, "{3}"},
+		{Positions{0, 4, 12}, "{0,4,12}"},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result, err := tc.positions.Value()
+		if err != nil {
+			t.Errorf("For positions '%v', unexpected error: %v", tc.positions, err)
+		}
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For positions '%v', expected '%s', but got '%v'", tc.positions, tc.expected, result)
+		}
+	}
+}
+
+func TestPositionsScan(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		src      interface{}
+		expected Positions
+	}{
+		{nil, nil},
+		{"{}", Positions{}},
+		{"{7}", Positions{7}},
+		{[]byte("{0,4,12}"), Positions{0, 4, 12}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		var result Positions
+		if err := result.Scan(tc.src); err != nil {
+			t.Errorf("For source '%v', unexpected error: %v", tc.src, err)
+			continue
+		}
+
+		// Compare the result with the expected value
+		if len(result) != len(tc.expected) || (result == nil) != (tc.expected == nil) {
+			t.Errorf("For source '%v', expected '%v', but got '%v'", tc.src, tc.expected, result)
+			continue
+		}
+		for i := range result {
+			if result[i] != tc.expected[i] {
+				t.Errorf("For source '%v', expected '%v', but got '%v'", tc.src, tc.expected, result)
+				break
+			}
+		}
+	}
+
+	// Invalid arrays are rejected
+	var result Positions
+	if err := result.Scan("{1,x}"); err == nil {
+		t.Error("Expected an error for an invalid array, but got none")
+	}
+	if err := result.Scan(42); err == nil {
+		t.Error("Expected an error for an unsupported source, but got none")
+	}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Redirect is one hop of a redirect chain: a url that answered with a redirect, and the status code of the answer.
+type Redirect struct {
+	Url        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// Redirects lists the redirects followed to fetch a url, first hop first. It is stored as a Postgres jsonb array.
+type Redirects []Redirect
+
+// Scan is a method on the Redirects type that reads a jsonb array of redirects.
+// A NULL value is read as no redirects.
+//
+// Parameters:
+// src interface{}: The value read from the database.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the method's execution.
+func (r *Redirects) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into Redirects", src)
+	}
+	var redirects Redirects
+	if err := json.Unmarshal(data, &redirects); err != nil {
+		return fmt.Errorf("invalid redirects %q: %w", data, err)
+	}
+	*r = redirects
+	return nil
+}
+
+// Value is a method on the Redirects type that writes the redirects as a json array.
+//
+// This method does not take any parameters.
+//
+// Returns:
+// driver.Value: The json array, [] when there are no redirects.
+// error: An error object if the redirects cannot be encoded.
+func (r Redirects) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]Redirect(r))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,70 @@
+package db
+
+import "testing"
+
+func TestRedirectsValue(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		redirects Redirects
+		expected  string
+	}{
+		{nil, "[]"},
+		{Redirects{}, "[]"},
+		{Redirects{{Url: "http://example.com/", StatusCode: 301}}, `[{"url":"http://example.com/","statusCode":301}]`},
+		{Redirects{{Url: "https://a.com/", StatusCode: 302}, {Url: "https://b.com/", StatusCode: 308}}, `[{"url":"https://a.com/","statusCode":302},{"url":"https://b.com/","statusCode":308}]`},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result, err := tc.redirects.Value()
+		if err != nil {
+			t.Errorf("For redirects '%v', unexpected error: %v", tc.redirects, err)
+		}
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For redirects '%v', expected '%s', but got '%v'", tc.redirects, tc.expected, result)
+		}
+	}
+}
+
+func TestRedirectsScan(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		src      interface{}
+		expected Redirects
+	}{
+		{nil, nil},
+		{"[]", Redirects{}},
+		{[]byte(`[{"url":"http://example.com/","statusCode":301}]`), Redirects{{Url: "http://example.com/", StatusCode: 301}}},
+		{`[{"url":"https://a.com/","statusCode":302},{"url":"https://b.com/","statusCode":308}]`, Redirects{{Url: "https://a.com/", StatusCode: 302}, {Url: "https://b.com/", StatusCode: 308}}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		var result Redirects
+		if err := result.Scan(tc.src); err != nil {
+			t.Errorf("For src '%v', unexpected error: %v", tc.src, err)
+		}
+
+		// Compare the result with the expected value
+		if len(result) != len(tc.expected) || (result == nil) != (tc.expected == nil) {
+			t.Errorf("For src '%v', expected '%v', but got '%v'", tc.src, tc.expected, result)
+			continue
+		}
+		for i := range result {
+			if result[i] != tc.expected[i] {
+				t.Errorf("For src '%v', expected '%v', but got '%v'", tc.src, tc.expected, result)
+			}
+		}
+	}
+
+	// Invalid values are rejected
+	var result Redirects
+	if err := result.Scan("{1,2}"); err == nil {
+		t.Error("Expected an error for a value that is not json, but got none")
+	}
+	if err := result.Scan(42); err == nil {
+		t.Error("Expected an error for a value that is not text, but got none")
+	}
+}
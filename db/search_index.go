@@ -5,17 +5,42 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SearchIndex struct {
-	ID        string `gorm:"type:uuid;default:uuid_generate_v4()"`
-	Value     string
+	ID        string         `gorm:"type:uuid;default:uuid_generate_v4()"`
+	Value     string         `gorm:"uniqueIndex:idx_search_index_values"`
 	Urls      []CrawledUrl   `gorm:"many2many:token_urls;"`
 	CreatedAt time.Time      `gorm:"autoCreateTime"`
 	UpdatedAt time.Time      `gorm:"autoUpdateTime"`
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// Posting records that a token appears on a crawled url, how many times and at which positions in each field.
+// Postings are stored in the token_urls join table.
+type Posting struct {
+	SearchIndexID        string    `gorm:"primaryKey;type:uuid"`
+	CrawledUrlID         string    `gorm:"primaryKey;type:uuid"`
+	Frequency            int       `gorm:"default:1"` // Occurrences across all fields
+	TitleFrequency       int       `gorm:"default:0"`
+	HeadingsFrequency    int       `gorm:"default:0"`
+	DescriptionFrequency int       `gorm:"default:0"`
+	UrlFrequency         int       `gorm:"default:0"`
+	BodyFrequency        int       `gorm:"default:0"`
+	TitlePositions       Positions `gorm:"type:integer[]"` // Word positions of the token in the field, counting stopwords
+	HeadingsPositions    Positions `gorm:"type:integer[]"`
+	DescriptionPositions Positions `gorm:"type:integer[]"`
+	UrlPositions         Positions `gorm:"type:integer[]"`
+	BodyPositions        Positions `gorm:"type:integer[]"`
+}
+
+// TableName is a function that returns the name of the database table associated with the Posting struct.
+// It returns the string "token_urls".
+func (p *Posting) TableName() string {
+	return "token_urls"
+}
+
 // TableName is a function that returns the name of the database table associated with the SearchIndex struct.
 // It returns the string "search_index".
 //
@@ -27,69 +52,205 @@ func (s *SearchIndex) TableName() string {
 	return "search_index"
 }
 
+// Batch sizes for bulk index writes. Postgres accepts at most 65535 parameters per statement,
+// so a batch times the number of columns it binds must stay below that.
+const (
+	tokenBatchSize   = 5000 // One parameter per token
+	postingBatchSize = 2000 // Thirteen columns per posting
+	lengthBatchSize  = 5000 // Seven columns per url, or one when deleting a url's postings
+)
+
 // Save is a method on the SearchIndex struct that saves the search index to the database.
-// It takes a map of strings to slices of strings, where the key is the search term and the value is a slice of URLs.
-// It also takes a slice of CrawledUrl objects that represent the URLs that have been crawled.
-// It iterates over the search index map and creates a new SearchIndex object for each search term.
-// It then associates the URLs with the search term and saves the search index to the database.
+// It takes a map of token values to postings, where each posting records a crawled URL the token appears on, how often and where.
+// It also takes a map of crawled URL IDs to field lengths, the number of tokens indexed in each field of each URL, which BM25F needs to normalise scores.
+// Everything is written in a single transaction with set-based statements instead of one round trip per token:
+// the earlier postings of every URL in docLengths are deleted, so a page that is indexed again has its postings replaced as a whole,
+// the token values are inserted in batches with INSERT ... ON CONFLICT DO NOTHING and their IDs read back,
+// the postings are upserted with multi-row inserts that replace the frequencies and positions already recorded for a URL,
+// and the field lengths and total document length of every crawled URL are updated from a VALUES list.
+// If any statement fails, nothing is saved.
 //
 // Parameters:
-// index map[string][]string: A map of strings to slices of strings, where the key is the search term and the value is a slice of URLs.
-// crawledUrls []CrawledUrl: A slice of CrawledUrl objects that represent the URLs that have been crawled.
+// index map[string][]Posting: A map of token values to the postings of that token. The SearchIndexID of each posting is filled in by Save.
+// docLengths map[string]FieldLengths: A map of crawled URL IDs to the number of tokens indexed in each field of the URL.
 //
 // Returns:
 // error: An error object that describes an error that occurred during the method's execution.
-func (s *SearchIndex) Save(index map[string][]string, crawledUrls []CrawledUrl) error {
-	for value, ids := range index {
-		newIndex := &SearchIndex{
-			Value: value,
+func (s *SearchIndex) Save(index map[string][]Posting, docLengths map[string]FieldLengths) error {
+	return DBConn.Transaction(func(tx *gorm.DB) error {
+		values := make([]string, 0, len(index))
+		for value := range index {
+			values = append(values, value)
 		}
-		if err := DBConn.Where(SearchIndex{Value: value}).FirstOrCreate(newIndex).Error; err != nil {
+		ids, err := upsertTokens(tx, values)
+		if err != nil {
 			return err
 		}
 
-		var urlsToAppend []CrawledUrl
-		for _, id := range ids {
-			for _, url := range crawledUrls {
-				if url.ID == id {
-					urlsToAppend = append(urlsToAppend, url)
-					break
-				}
+		// Drop the postings of urls being indexed again, so tokens that are no longer on a page do not stay attached to it
+		if err := deletePostings(tx, docIDs(docLengths)); err != nil {
+			return err
+		}
+
+		var postings []Posting
+		for value, tokenPostings := range index {
+			for i := range tokenPostings {
+				tokenPostings[i].SearchIndexID = ids[value]
+			}
+			postings = append(postings, tokenPostings...)
+		}
+		if len(postings) > 0 {
+			// Replace the frequencies and positions if the token was already recorded for the url
+			err = tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "search_index_id"}, {Name: "crawled_url_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{
+					"frequency", "title_frequency", "headings_frequency", "description_frequency", "url_frequency", "body_frequency",
+					"title_positions", "headings_positions", "description_positions", "url_positions", "body_positions",
+				}),
+			}).CreateInBatches(&postings, postingBatchSize).Error
+			if err != nil {
+				return err
 			}
 		}
 
-		if err := DBConn.Model(&newIndex).Association("Urls").Append(&urlsToAppend); err != nil {
+		return updateDocLengths(tx, docLengths)
+	})
+}
+
+// upsertTokens inserts the token values that are not stored yet, restores the deleted ones, and returns the ID of every value.
+// Deleted tokens are restored rather than reused as they are, since postings of deleted tokens are not loaded by EachPosting.
+func upsertTokens(tx *gorm.DB, values []string) (map[string]string, error) {
+	ids := make(map[string]string, len(values))
+	for start := 0; start < len(values); start += tokenBatchSize {
+		batch := values[start:min(start+tokenBatchSize, len(values))]
+		args := make([]interface{}, len(batch))
+		for i, value := range batch {
+			args[i] = value
+		}
+		rows := strings.TrimSuffix(strings.Repeat("(?, now(), now()),", len(batch)), ",")
+		err := tx.Exec("INSERT INTO search_index (value, created_at, updated_at) VALUES "+rows+" ON CONFLICT (value) DO UPDATE SET deleted_at = NULL, updated_at = now() WHERE search_index.deleted_at IS NOT NULL", args...).Error
+		if err != nil {
+			return nil, err
+		}
+		var stored []SearchIndex
+		err = tx.Select("id", "value").Where("value IN ?", batch).Find(&stored).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, token := range stored {
+			ids[token.Value] = token.ID
+		}
+	}
+	return ids, nil
+}
+
+// docIDs returns the url IDs of the field lengths.
+func docIDs(docLengths map[string]FieldLengths) []string {
+	ids := make([]string, 0, len(docLengths))
+	for id := range docLengths {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// deletePostings deletes every posting of the urls, a batch of urls per statement.
+func deletePostings(tx *gorm.DB, ids []string) error {
+	for start := 0; start < len(ids); start += lengthBatchSize {
+		batch := ids[start:min(start+lengthBatchSize, len(ids))]
+		if err := tx.Where("crawled_url_id IN ?", batch).Delete(&Posting{}).Error; err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// FullTextSearch is a method on the SearchIndex struct that performs a full-text search on the search index.
-// It takes a string value as input and splits it into individual terms.
-// It then retrieves all search indexes that contain any of the terms and retrieves the associated URLs.
-// It returns a slice of CrawledUrl objects that match the search terms.
+// DeleteUrlPostings is a method on the SearchIndex struct that removes crawled URLs from the search index by deleting all their postings.
+// It is used for pages that can no longer be fetched, so searches stop returning them.
 //
 // Parameters:
-// value string: The search query string.
+// ids []string: The IDs of the crawled URLs to remove.
 //
 // Returns:
-// []CrawledUrl: A slice of CrawledUrl objects that match the search query.
 // error: An error object that describes an error that occurred during the method's execution.
-func (s *SearchIndex) FullTextSearch(value string) ([]CrawledUrl, error) {
-	terms := strings.Fields(value)
-	var urls []CrawledUrl
-
-	for _, term := range terms {
-		var searchIndexes []SearchIndex
-		if err := DBConn.Preload("Urls").Where("value LIKE ?", "%"+term+"%").Find(&searchIndexes).Error; err != nil {
-			// Preload is used to eager load the associated URLs with the search index
-			return nil, err
+func (s *SearchIndex) DeleteUrlPostings(ids []string) error {
+	return DBConn.Transaction(func(tx *gorm.DB) error {
+		return deletePostings(tx, ids)
+	})
+}
+
+// updateDocLengths stores the field lengths and total document length of every url, a batch of urls per statement.
+func updateDocLengths(tx *gorm.DB, docLengths map[string]FieldLengths) error {
+	ids := docIDs(docLengths)
+	for start := 0; start < len(ids); start += lengthBatchSize {
+		batch := ids[start:min(start+lengthBatchSize, len(ids))]
+		args := make([]interface{}, 0, len(batch)*7)
+		for _, id := range batch {
+			lengths := docLengths[id]
+			args = append(args, id, lengths.Total(), lengths.TitleLength, lengths.HeadingsLength, lengths.DescriptionLength, lengths.UrlLength, lengths.BodyLength)
 		}
+		rows := strings.TrimSuffix(strings.Repeat("(?::uuid, ?::bigint, ?::bigint, ?::bigint, ?::bigint, ?::bigint, ?::bigint),", len(batch)), ",")
+		err := tx.Exec(`UPDATE crawled_urls AS c SET
+			doc_length = v.doc_length,
+			title_length = v.title_length,
+			headings_length = v.headings_length,
+			description_length = v.description_length,
+			url_length = v.url_length,
+			body_length = v.body_length
+			FROM (VALUES `+rows+`) AS v (id, doc_length, title_length, headings_length, description_length, url_length, body_length)
+			WHERE c.id = v.id`, args...).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeDuplicateTokens makes every token value appear once in the search_index table, so a unique index can be created on it.
+// The postings of a duplicate are moved to the oldest row with the same value, unless that row already has a posting for the url,
+// and the duplicate rows are then deleted. It does nothing when the values are already unique.
+func mergeDuplicateTokens(tx *gorm.DB) error {
+	duplicates := `SELECT id, first_value(id) OVER (PARTITION BY value ORDER BY created_at, id) AS keep FROM search_index`
+	err := tx.Exec(`UPDATE token_urls AS t SET search_index_id = d.keep
+		FROM (` + duplicates + `) AS d
+		WHERE t.search_index_id = d.id AND d.id <> d.keep
+		AND NOT EXISTS (SELECT 1 FROM token_urls k WHERE k.search_index_id = d.keep AND k.crawled_url_id = t.crawled_url_id)`).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Exec(`DELETE FROM token_urls WHERE search_index_id IN (SELECT id FROM (` + duplicates + `) AS d WHERE d.id <> d.keep)`).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`DELETE FROM search_index WHERE id IN (SELECT id FROM (` + duplicates + `) AS d WHERE d.id <> d.keep)`).Error
+}
 
-		for _, searchIndex := range searchIndexes {
-			urls = append(urls, searchIndex.Urls...)
+// EachPosting is a method on the SearchIndex struct that streams every posting of an indexed URL from the database.
+// The rows are read one at a time, so the whole token_urls table is never held in memory at once.
+//
+// Parameters:
+// fn func(value string, posting Posting): The function called with each posting and the value of its token.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the method's execution.
+func (s *SearchIndex) EachPosting(fn func(value string, posting Posting)) error {
+	rows, err := DBConn.Table("token_urls").
+		Select("token_urls.*, search_index.value").
+		Joins("JOIN search_index ON search_index.id = token_urls.search_index_id AND search_index.deleted_at IS NULL").
+		Joins("JOIN crawled_urls ON crawled_urls.id = token_urls.crawled_url_id AND crawled_urls.indexed AND crawled_urls.success AND crawled_urls.deleted_at IS NULL").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row struct {
+			Posting
+			Value string
+		}
+		if err := DBConn.ScanRows(rows, &row); err != nil {
+			return err
 		}
+		fn(row.Value, row.Posting)
 	}
-	return urls, nil
+	return rows.Err()
 }
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// Size of the synthetic corpus used by the benchmarks.
+const (
+	benchDocs        = 500  // Number of crawled urls
+	benchVocabulary  = 5000 // Number of distinct tokens
+	benchDocTokens   = 120  // Tokens per url
+	benchSchemaName  = "fiber_search_bench"
+	benchTitleTokens = 8 // Tokens of each url that are in its title
+)
+
+// syntheticCorpus returns an index of urls whose tokens follow a Zipf distribution, like the words of real pages.
+func syntheticCorpus(ids []string) (map[string][]Posting, map[string]FieldLengths) {
+	rng := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(rng, 1.1, 1, benchVocabulary-1)
+	index := map[string][]Posting{}
+	docLengths := map[string]FieldLengths{}
+	for _, id := range ids {
+		postings := map[string]*Posting{}
+		for position := 0; position < benchDocTokens; position++ {
+			token := fmt.Sprintf("token%d", zipf.Uint64())
+			posting, ok := postings[token]
+			if !ok {
+				posting = &Posting{CrawledUrlID: id}
+				postings[token] = posting
+			}
+			posting.Frequency++
+			if position < benchTitleTokens {
+				posting.TitleFrequency++
+				posting.TitlePositions = append(posting.TitlePositions, position)
+			} else {
+				posting.DescriptionFrequency++
+				posting.DescriptionPositions = append(posting.DescriptionPositions, position-benchTitleTokens)
+			}
+		}
+		for token, posting := range postings {
+			index[token] = append(index[token], *posting)
+		}
+		docLengths[id] = FieldLengths{TitleLength: benchTitleTokens, DescriptionLength: benchDocTokens - benchTitleTokens}
+	}
+	return index, docLengths
+}
+
+// saveSearchIndexPerToken is how the search index was saved before bulk writes: a FirstOrCreate and an upsert per token
+// and an update per url, each in its own round trip. It is kept to compare against Save.
+func saveSearchIndexPerToken(index map[string][]Posting, docLengths map[string]FieldLengths) error {
+	for value, postings := range index {
+		newIndex := &SearchIndex{
+			Value: value,
+		}
+		if err := DBConn.Where(SearchIndex{Value: value}).FirstOrCreate(newIndex).Error; err != nil {
+			return err
+		}
+		for i := range postings {
+			postings[i].SearchIndexID = newIndex.ID
+		}
+		err := DBConn.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "search_index_id"}, {Name: "crawled_url_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"frequency", "title_frequency", "headings_frequency", "description_frequency", "url_frequency", "body_frequency",
+				"title_positions", "headings_positions", "description_positions", "url_positions", "body_positions",
+			}),
+		}).Create(&postings).Error
+		if err != nil {
+			return err
+		}
+	}
+	for id, lengths := range docLengths {
+		err := DBConn.Model(&CrawledUrl{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"doc_length":         lengths.Total(),
+			"title_length":       lengths.TitleLength,
+			"headings_length":    lengths.HeadingsLength,
+			"description_length": lengths.DescriptionLength,
+			"url_length":         lengths.UrlLength,
+			"body_length":        lengths.BodyLength,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupBenchDB connects to the database in DATABASE_URL and creates the index tables in a schema of their own,
+// which is dropped when the benchmark ends. The benchmark is skipped when DATABASE_URL is not set.
+func setupBenchDB(b *testing.B) []string {
+	dburl := os.Getenv("DATABASE_URL")
+	if dburl == "" {
+		b.Skip("DATABASE_URL is not set")
+	}
+	admin, err := gorm.Open(postgres.Open(dburl), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := admin.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`).Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := admin.Exec("DROP SCHEMA IF EXISTS " + benchSchemaName + " CASCADE").Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := admin.Exec("CREATE SCHEMA " + benchSchemaName).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	// Point every connection at the benchmark schema, keeping public for the uuid functions
+	searchPath := benchSchemaName + ",public"
+	if u, err := url.Parse(dburl); err == nil && u.Scheme != "" {
+		query := u.Query()
+		query.Set("search_path", searchPath)
+		u.RawQuery = query.Encode()
+		dburl = u.String()
+	} else {
+		dburl += " search_path=" + searchPath
+	}
+	previous := DBConn
+	DBConn, err = gorm.Open(postgres.Open(dburl), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		DBConn = previous
+		admin.Exec("DROP SCHEMA IF EXISTS " + benchSchemaName + " CASCADE")
+	})
+	if err := DBConn.SetupJoinTable(&SearchIndex{}, "Urls", &Posting{}); err != nil {
+		b.Fatal(err)
+	}
+	if err := DBConn.AutoMigrate(&CrawledUrl{}, &SearchIndex{}); err != nil {
+		b.Fatal(err)
+	}
+
+	urls := make([]CrawledUrl, benchDocs)
+	for i := range urls {
+		urls[i] = CrawledUrl{Url: fmt.Sprintf("https://example%d.com/page", i)}
+	}
+	if err := DBConn.CreateInBatches(&urls, 500).Error; err != nil {
+		b.Fatal(err)
+	}
+	ids := make([]string, len(urls))
+	for i, u := range urls {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+// BenchmarkSearchIndexSave indexes a synthetic corpus into empty tables, once with the bulk Save and once with
+// the old per-token writes. Run it against a Postgres database with:
+//
+//	DATABASE_URL=postgres://... go test ./db -run '^$' -bench SearchIndexSave -benchtime 3x
+func BenchmarkSearchIndexSave(b *testing.B) {
+	ids := setupBenchDB(b)
+	implementations := []struct {
+		name string
+		save func(map[string][]Posting, map[string]FieldLengths) error
+	}{
+		{"Bulk", (&SearchIndex{}).Save},
+		{"PerToken", saveSearchIndexPerToken},
+	}
+	for _, impl := range implementations {
+		b.Run(impl.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if err := DBConn.Exec("TRUNCATE token_urls, search_index").Error; err != nil {
+					b.Fatal(err)
+				}
+				index, docLengths := syntheticCorpus(ids)
+				postings := 0
+				for _, tokenPostings := range index {
+					postings += len(tokenPostings)
+				}
+				b.StartTimer()
+
+				if err := impl.save(index, docLengths); err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(float64(len(index)), "tokens/op")
+				b.ReportMetric(float64(postings), "postings/op")
+			}
+		})
+	}
+}
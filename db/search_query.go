@@ -0,0 +1,60 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// SearchQuery counts how many times a query was searched for, so popular queries can be suggested.
+type SearchQuery struct {
+	Query     string    `gorm:"primaryKey" json:"query"` // The query, lowercased with its whitespace collapsed
+	Count     int       `json:"count"`                   // Number of times the query was searched for
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// AddCounts is a method on the SearchQuery struct that adds to the number of times queries were searched for.
+// Queries that were never searched for before are inserted, and the counts of the others are increased.
+//
+// Parameters:
+// counts map[string]int: The number of new searches for each query.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the method's execution.
+func (q *SearchQuery) AddCounts(counts map[string]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	queries := make([]SearchQuery, 0, len(counts))
+	for query, count := range counts {
+		queries = append(queries, SearchQuery{Query: query, Count: count})
+	}
+	tx := DBConn.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "query"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":      clause.Expr{SQL: "search_queries.count + excluded.count"},
+			"updated_at": clause.Expr{SQL: "excluded.updated_at"},
+		}),
+	}).CreateInBatches(&queries, 1000)
+	return tx.Error
+}
+
+// GetPopular is a method on the SearchQuery struct that retrieves the queries searched for most often.
+// Queries searched for fewer than minCount times are left out.
+//
+// Parameters:
+// limit int: The maximum number of queries to retrieve.
+// minCount int: The number of times a query must have been searched for.
+//
+// Returns:
+// []SearchQuery: The queries, most searched for first.
+// error: An error object that describes an error that occurred during the method's execution.
+func (q *SearchQuery) GetPopular(limit int, minCount int) ([]SearchQuery, error) {
+	var queries []SearchQuery
+	tx := DBConn.Where("count >= ?", minCount).Order("count DESC").Order("query").Limit(limit).Find(&queries)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return queries, nil
+}
@@ -5,11 +5,23 @@ import (
 )
 
 type SearchSettings struct {
-	ID        uint      `gorm:"primarykey" json:"id"`
-	SearchOn  bool      `json:"searchOn"`
-	AddNew    bool      `json:"addNew"`
-	Amount    uint      `json:"amount"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID               uint      `gorm:"primarykey" json:"id"`
+	SearchOn         bool      `json:"searchOn"`
+	AddNew           bool      `json:"addNew"`
+	Amount           uint      `json:"amount"`
+	Concurrency      uint      `json:"concurrency" gorm:"default:8"`         // Number of urls crawled at the same time
+	HostMaxInFlight  uint      `json:"hostMaxInFlight" gorm:"default:2"`     // Maximum concurrent requests to a single host
+	HostDelay        uint      `json:"hostDelay" gorm:"default:1000"`        // Minimum gap in milliseconds between two requests to a single host
+	MaxDepth         uint      `json:"maxDepth" gorm:"default:3"`            // Maximum number of internal links followed from a site's entry point
+	DomainPageBudget uint      `json:"domainPageBudget" gorm:"default:500"`  // Maximum number of urls stored for a single host, 0 for no limit
+	TitleBoost       float64   `json:"titleBoost" gorm:"default:3"`          // Weight of a match in the page title
+	HeadingsBoost    float64   `json:"headingsBoost" gorm:"default:2"`       // Weight of a match in the page headings
+	DescriptionBoost float64   `json:"descriptionBoost" gorm:"default:1"`    // Weight of a match in the page description
+	UrlBoost         float64   `json:"urlBoost" gorm:"default:0.5"`          // Weight of a match in the url
+	BodyBoost        float64   `json:"bodyBoost" gorm:"default:1"`           // Weight of a match in the body text
+	HighlightPre     string    `json:"highlightPre" gorm:"default:<mark>"`   // Inserted before a matched term in result snippets
+	HighlightPost    string    `json:"highlightPost" gorm:"default:</mark>"` // Inserted after a matched term in result snippets
+	UpdatedAt        time.Time `json:"updatedAt"`
 }
 
 // Get is a method on the SearchSettings struct that retrieves the search settings from the database.
@@ -25,14 +37,14 @@ func (s *SearchSettings) Get() error {
 }
 
 // Update is a method on the SearchSettings struct that updates the search settings in the database.
-// It updates the search_on, add_new, amount, and updated_at fields in the database with the values from the SearchSettings struct.
+// It updates the search_on, add_new, amount, concurrency, host_max_in_flight, host_delay, max_depth, domain_page_budget, the field boosts, the highlight markers, and updated_at fields in the database with the values from the SearchSettings struct.
 //
 // This method does not take any parameters.
 //
 // Returns:
 // error: An error object that describes an error that occurred during the method's execution.
 func (s *SearchSettings) Update() error {
-	tx := DBConn.Select("search_on", "add_new", "amount", "updated_at").Where("id = 1").Updates(&s)
+	tx := DBConn.Select("search_on", "add_new", "amount", "concurrency", "host_max_in_flight", "host_delay", "max_depth", "domain_page_budget", "title_boost", "headings_boost", "description_boost", "url_boost", "body_boost", "highlight_pre", "highlight_post", "updated_at").Where("id = 1").Updates(&s)
 	if tx.Error != nil {
 		return tx.Error
 	}
@@ -5,19 +5,62 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Crawl statuses recorded on CrawledUrl.Status.
+const (
+	StatusOk               = "ok"                 // The page was fetched and parsed
+	StatusFailed           = "failed"             // The request failed or the response could not be used
+	StatusRobotsDisallowed = "robots_disallowed"  // The site's robots.txt does not allow us to fetch the page
+	StatusNotCanonical     = "not_canonical"      // The page is a duplicate of its canonical url, which is indexed instead
+	StatusRedirected       = "redirected"         // The url permanently redirects to another url, which is indexed instead
+	StatusRedirectLoop     = "redirect_loop"      // Following the redirects of the url leads back to a url already visited
+	StatusTooManyRedirects = "too_many_redirects" // The url redirects more times than the crawler follows
+)
+
+// FieldLengths holds the number of tokens indexed in each field of a crawled url.
+type FieldLengths struct {
+	TitleLength       int `json:"titleLength" gorm:"default:0"`
+	HeadingsLength    int `json:"headingsLength" gorm:"default:0"`
+	DescriptionLength int `json:"descriptionLength" gorm:"default:0"`
+	UrlLength         int `json:"urlLength" gorm:"default:0"`
+	BodyLength        int `json:"bodyLength" gorm:"default:0"`
+}
+
+// Total returns the number of tokens indexed across all fields.
+func (f FieldLengths) Total() int {
+	return f.TitleLength + f.HeadingsLength + f.DescriptionLength + f.UrlLength + f.BodyLength
+}
+
 type CrawledUrl struct {
-	ID              string         `json:"id" gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
-	Url             string         `json:"url" gorm:"unique;not null"`
-	Success         bool           `json:"success" gorm:"default:null"`
-	CrawlDuration   time.Duration  `json:"crawlDuration"`
-	ResponseCode    int            `json:"responseCode" gorm:"type:smallint"`
-	PageTitle       string         `json:"pageTitle"`
-	PageDescription string         `json:"pageDescription"`
-	Headings        string         `json:"headings"`
-	LastTested      *time.Time     `json:"lastTested"` // Use pointer so this value can be nil
-	Indexed         bool           `json:"indexed" gorm:"default:false"`
+	ID              string        `json:"id" gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
+	Url             string        `json:"url" gorm:"unique;not null"`
+	Host            string        `json:"host" gorm:"index"`
+	Depth           int           `json:"depth" gorm:"default:0"` // Number of internal links followed from the site's entry point
+	Success         bool          `json:"success" gorm:"default:null"`
+	Status          string        `json:"status" gorm:"index"`
+	CrawlDuration   time.Duration `json:"crawlDuration"`
+	ResponseCode    int           `json:"responseCode" gorm:"type:smallint"`
+	PageTitle       string        `json:"pageTitle"`
+	PageDescription string        `json:"pageDescription"`
+	Headings        string        `json:"headings"`
+	BodyText        string        `json:"-"`          // Visible text of the page, capped in size. Too large to send with every url
+	LastTested      *time.Time    `json:"lastTested"` // Use pointer so this value can be nil
+	Indexed         bool          `json:"indexed" gorm:"default:false"`
+	DocLength       int           `json:"docLength" gorm:"default:0"` // Number of tokens indexed for the page
+	FieldLengths    `gorm:"embedded"`
+	Priority        int            `json:"priority" gorm:"default:0;index"` // Higher priority urls are crawled first
+	NextCrawlAt     *time.Time     `json:"nextCrawlAt" gorm:"index"`        // When the url is due to be crawled, nil means as soon as possible
+	RecrawlInterval time.Duration  `json:"recrawlInterval"`                 // Adapts to how often the page content changes
+	FailCount       int            `json:"failCount" gorm:"default:0"`      // Consecutive failed crawls, used for the retry backoff
+	ContentHash     string         `json:"contentHash"`                     // Hash of the extracted content, used to detect changes
+	SimHash         int64          `json:"simHash" gorm:"default:0"`        // Fingerprint of the body text that near-duplicate pages share, zero if unknown
+	CanonicalUrl    string         `json:"canonicalUrl"`                    // The url that represents the page when it is not this url
+	Etag            string         `json:"etag"`                            // ETag header of the last successful crawl, used to make the next crawl conditional
+	LastModified    string         `json:"lastModified"`                    // Last-Modified header of the last successful crawl, used to make the next crawl conditional
+	Redirects       Redirects      `json:"redirects" gorm:"type:jsonb"`     // Redirects followed by the last crawl, first hop first
+	RedirectUrl     string         `json:"redirectUrl"`                     // Where the url permanently redirects to, empty if it does not
 	CreatedAt       *time.Time     `gorm:"autoCreateTime"`
 	UpdatedAt       time.Time      `gorm:"autoUpdateTime"`
 	DeletedAt       gorm.DeletedAt `gorm:"index"`
@@ -32,7 +75,7 @@ type CrawledUrl struct {
 // Returns:
 // error: An error object that describes an error that occurred during the method's execution.
 func (crawled *CrawledUrl) UpdateUrl(input CrawledUrl) error {
-	tx := DBConn.Select("url", "success", "crawl_duration", "response_code", "page_title", "page_description", "headings", "last_tested", "updated_at").Omit("created_at").Save(&input)
+	tx := DBConn.Select("url", "success", "status", "crawl_duration", "response_code", "page_title", "page_description", "headings", "body_text", "last_tested", "next_crawl_at", "recrawl_interval", "fail_count", "content_hash", "sim_hash", "canonical_url", "etag", "last_modified", "redirects", "redirect_url", "indexed", "updated_at").Omit("created_at").Save(&input)
 	if tx.Error != nil {
 		fmt.Print(tx.Error)
 		return tx.Error
@@ -40,8 +83,12 @@ func (crawled *CrawledUrl) UpdateUrl(input CrawledUrl) error {
 	return nil
 }
 
-// GetNextCrawlUrls is a method on the CrawledUrl struct that retrieves the next URLs to crawl from the database.
-// It fetches the URLs that have not been tested yet and limits the number of URLs to the specified limit.
+// GetNextCrawlUrls is a method on the CrawledUrl struct that retrieves the next URLs to crawl from the frontier.
+// It fetches the URLs that are due, meaning they have never been scheduled or their next crawl time has passed,
+// ordered by priority and then by how long they have been due, and limits the number of URLs to the specified limit.
+// The returned URLs are leased to the caller by moving their next crawl time CrawlLease into the future,
+// so an overlapping crawl run does not pick them up and a run that dies before finishing gets them back later.
+// Rows locked by another run are skipped.
 //
 // Parameters:
 // limit int: The maximum number of URLs to retrieve.
@@ -51,10 +98,29 @@ func (crawled *CrawledUrl) UpdateUrl(input CrawledUrl) error {
 // error: An error object that describes an error that occurred during the method's execution.
 func (crawled *CrawledUrl) GetNextCrawlUrls(limit int) ([]CrawledUrl, error) {
 	var urls []CrawledUrl
-	tx := DBConn.Where("last_tested IS NULL").Limit(limit).Find(&urls)
-	if tx.Error != nil {
-		fmt.Print(tx.Error)
-		return []CrawledUrl{}, tx.Error
+	now := time.Now()
+	err := DBConn.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_crawl_at IS NULL OR next_crawl_at <= ?", now).
+			Order("priority DESC").
+			Order("next_crawl_at ASC NULLS FIRST").
+			Limit(limit).
+			Find(&urls).Error
+		if err != nil {
+			return err
+		}
+		if len(urls) == 0 {
+			return nil
+		}
+		ids := make([]string, len(urls))
+		for i, url := range urls {
+			ids[i] = url.ID
+		}
+		return tx.Model(&CrawledUrl{}).Where("id IN ?", ids).Update("next_crawl_at", now.Add(CrawlLease)).Error
+	})
+	if err != nil {
+		fmt.Print(err)
+		return []CrawledUrl{}, err
 	}
 	return urls, nil
 }
@@ -75,8 +141,96 @@ func (crawled *CrawledUrl) Save() error {
 	return nil
 }
 
+// GetByUrl is a method on the CrawledUrl struct that retrieves a stored URL by its address.
+//
+// Parameters:
+// url string: The normalized URL to retrieve.
+//
+// Returns:
+// CrawledUrl: The stored URL, with an empty ID if the URL is not stored.
+// error: An error object that describes an error that occurred during the method's execution.
+func (crawled *CrawledUrl) GetByUrl(url string) (CrawledUrl, error) {
+	var found CrawledUrl
+	tx := DBConn.Where("url = ?", url).Limit(1).Find(&found)
+	if tx.Error != nil {
+		fmt.Print(tx.Error)
+		return CrawledUrl{}, tx.Error
+	}
+	return found, nil
+}
+
+// SaveNew is a method on the CrawledUrl struct that adds newly found URLs to the frontier.
+// URLs that are already in the database are skipped, so a page found again keeps its crawl history and schedule.
+//
+// Parameters:
+// urls []CrawledUrl: A slice of CrawledUrl objects representing the URLs to add.
+//
+// Returns:
+// int64: The number of URLs that were added.
+// error: An error object that describes an error that occurred during the method's execution.
+func (crawled *CrawledUrl) SaveNew(urls []CrawledUrl) (int64, error) {
+	if len(urls) == 0 {
+		return 0, nil
+	}
+	tx := DBConn.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&urls, 500)
+	if tx.Error != nil {
+		fmt.Print(tx.Error)
+		return 0, tx.Error
+	}
+	return tx.RowsAffected, nil
+}
+
+// CountByHost is a method on the CrawledUrl struct that counts the URLs stored for a host.
+// It is used to enforce the per-domain page budget.
+//
+// Parameters:
+// host string: The lower case host to count URLs for.
+//
+// Returns:
+// int64: The number of URLs stored for the host.
+// error: An error object that describes an error that occurred during the method's execution.
+func (crawled *CrawledUrl) CountByHost(host string) (int64, error) {
+	var count int64
+	tx := DBConn.Model(&CrawledUrl{}).Where("host = ?", host).Count(&count)
+	if tx.Error != nil {
+		fmt.Print(tx.Error)
+		return 0, tx.Error
+	}
+	return count, nil
+}
+
+// storedBatchSize is the number of urls looked up per statement by Stored.
+const storedBatchSize = 5000
+
+// Stored is a method on the CrawledUrl struct that finds which of a list of URLs are already in the database.
+// Deleted rows count as stored, since SaveNew skips them too.
+//
+// Parameters:
+// urls []string: The URLs to look up.
+//
+// Returns:
+// map[string]bool: The URLs of the list that are already stored.
+// error: An error object that describes an error that occurred during the method's execution.
+func (crawled *CrawledUrl) Stored(urls []string) (map[string]bool, error) {
+	stored := map[string]bool{}
+	for start := 0; start < len(urls); start += storedBatchSize {
+		var found []string
+		batch := urls[start:min(start+storedBatchSize, len(urls))]
+		tx := DBConn.Unscoped().Model(&CrawledUrl{}).Where("url IN ?", batch).Pluck("url", &found)
+		if tx.Error != nil {
+			fmt.Print(tx.Error)
+			return map[string]bool{}, tx.Error
+		}
+		for _, url := range found {
+			stored[url] = true
+		}
+	}
+	return stored, nil
+}
+
 // GetNotIndexed is a method on the CrawledUrl struct that retrieves the URLs that have not been indexed from the database.
-// It fetches the URLs that have not been indexed and have been tested, and returns them as a slice of CrawledUrl objects.
+// It fetches the URLs that have not been indexed and whose last crawl succeeded, and returns them as a slice of CrawledUrl objects.
+// URLs that failed are left out so they stay out of the index until a crawl succeeds again.
 //
 // This method does not take any parameters.
 //
@@ -85,7 +239,7 @@ func (crawled *CrawledUrl) Save() error {
 // error: An error object that describes an error that occurred during the method's execution.
 func (crawled *CrawledUrl) GetNotIndexed() ([]CrawledUrl, error) {
 	var urls []CrawledUrl
-	tx := DBConn.Where("indexed = ? AND last_tested IS NOT NULL", false).Find(&urls)
+	tx := DBConn.Where("indexed = ? AND success = ? AND last_tested IS NOT NULL", false, true).Find(&urls)
 	if tx.Error != nil {
 		fmt.Print(tx.Error)
 		return []CrawledUrl{}, tx.Error
@@ -94,21 +248,60 @@ func (crawled *CrawledUrl) GetNotIndexed() ([]CrawledUrl, error) {
 }
 
 // SetIndexedTrue is a method on the CrawledUrl struct that sets the indexed flag to true for a slice of CrawledUrl objects.
-// It takes a slice of CrawledUrl objects and sets the indexed flag to true for each URL in the slice.
+// It takes a slice of CrawledUrl objects and sets the indexed flag to true for every URL in the slice with a single update,
+// leaving the other columns of the rows untouched.
+// A URL that was updated after readAt, because it was crawled again while it was being indexed, is left not indexed
+// so its new content is indexed by the next run.
 //
 // Parameters:
 // urls []CrawledUrl: A slice of CrawledUrl objects representing the URLs to mark as indexed.
+// readAt time.Time: The time just before the URLs were read for indexing.
 //
 // Returns:
+// []string: The IDs of the URLs that were marked as indexed.
 // error: An error object that describes an error that occurred during the method's execution.
-func (crawled *CrawledUrl) SetIndexedTrue(urls []CrawledUrl) error {
-	for _, url := range urls {
-		url.Indexed = true
-		tx := DBConn.Save(&url)
-		if tx.Error != nil {
-			fmt.Print(tx.Error)
-			return tx.Error
-		}
+func (crawled *CrawledUrl) SetIndexedTrue(urls []CrawledUrl, readAt time.Time) ([]string, error) {
+	indexed := []string{}
+	if len(urls) == 0 {
+		return indexed, nil
 	}
-	return nil
+	ids := make([]string, len(urls))
+	for i, url := range urls {
+		ids[i] = url.ID
+	}
+	tx := DBConn.Raw("UPDATE crawled_urls SET indexed = true WHERE id IN ? AND updated_at <= ? RETURNING id", ids, readAt).Scan(&indexed)
+	if tx.Error != nil {
+		fmt.Print(tx.Error)
+		return nil, tx.Error
+	}
+	return indexed, nil
+}
+
+// GetIndexed is a method on the CrawledUrl struct that retrieves the URLs that have been indexed from the database.
+// URLs whose last crawl failed are left out.
+//
+// This method does not take any parameters.
+//
+// Returns:
+// []CrawledUrl: A slice of CrawledUrl objects representing the URLs that have been indexed.
+// error: An error object that describes an error that occurred during the method's execution.
+func (crawled *CrawledUrl) GetIndexed() ([]CrawledUrl, error) {
+	var urls []CrawledUrl
+	tx := DBConn.Where("indexed = ? AND success = ?", true, true).Find(&urls)
+	if tx.Error != nil {
+		fmt.Print(tx.Error)
+		return []CrawledUrl{}, tx.Error
+	}
+	return urls, nil
+}
+
+// IndexStats holds the collection statistics used for ranking.
+type IndexStats struct {
+	Count                int64   // Number of indexed urls
+	AvgDocLength         float64 // Average number of tokens indexed per url
+	AvgTitleLength       float64
+	AvgHeadingsLength    float64
+	AvgDescriptionLength float64
+	AvgUrlLength         float64
+	AvgBodyLength        float64
 }
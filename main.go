@@ -3,6 +3,7 @@ package main
 import (
 	"fiber-search-engine/db"
 	"fiber-search-engine/routes"
+	"fiber-search-engine/search"
 	"fiber-search-engine/utils"
 	"fmt"
 	"log"
@@ -34,6 +35,10 @@ func main() {
 
 	app.Use(compress.New())
 	db.InitDB()
+	if err := search.LoadIndex(); err != nil {
+		fmt.Println("Failed to load the search index")
+		panic(err)
+	}
 	routes.SetRoutes(app)
 	utils.StartCronJobs()
 	// Start our server and listen for a shutdown
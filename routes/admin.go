@@ -2,11 +2,13 @@ package routes
 
 import (
 	"fiber-search-engine/db"
+	"fiber-search-engine/search"
 	"fiber-search-engine/utils"
 	"fiber-search-engine/views"
 	"fmt"
+	"html"
 	"os"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -35,19 +37,31 @@ func DashboardHandler(c *fiber.Ctx) error {
 		c.Status(500)
 		return c.SendString("<h2>Error: Something went wrong</h2>")
 	}
-	amount := strconv.FormatUint(uint64(settings.Amount), 10)
-	return render(c, views.Home(amount, settings.SearchOn, settings.AddNew))
+	return render(c, views.Home(*settings))
 }
 
 type settingsform struct {
-	Amount   uint   `form:"amount"`
-	SearchOn string `form:"searchOn"`
-	AddNew   string `form:"addNew"`
+	Amount           uint    `form:"amount"`
+	Concurrency      uint    `form:"concurrency"`
+	HostMaxInFlight  uint    `form:"hostMaxInFlight"`
+	HostDelay        uint    `form:"hostDelay"`
+	MaxDepth         uint    `form:"maxDepth"`
+	DomainPageBudget uint    `form:"domainPageBudget"`
+	TitleBoost       float64 `form:"titleBoost"`
+	HeadingsBoost    float64 `form:"headingsBoost"`
+	DescriptionBoost float64 `form:"descriptionBoost"`
+	UrlBoost         float64 `form:"urlBoost"`
+	BodyBoost        float64 `form:"bodyBoost"`
+	HighlightPre     string  `form:"highlightPre"`
+	HighlightPost    string  `form:"highlightPost"`
+	SearchOn         string  `form:"searchOn"`
+	AddNew           string  `form:"addNew"`
 }
 
 // DashboardPostHandler is a Fiber handler function that processes the form submission from the dashboard view.
 // It parses the form data into a settingsform struct and updates the search settings in the database.
 // If there is an error parsing the form data or updating the settings, it responds with a 500 status code and an error message.
+// If the highlight markers are not allowed by search.ValidateMarkers, it responds with a 400 status code and an error message.
 // If the settings are updated successfully, it responds with a 200 status code and triggers a refresh of the dashboard view.
 //
 // Parameters:
@@ -61,6 +75,11 @@ func DashboardPostHandler(c *fiber.Ctx) error {
 		c.Status(500)
 		return c.SendString("<h2>Error: Something went wrong</h2>")
 	}
+	// Highlight markers are written into snippets unescaped, so only allowed tags are saved
+	if err := search.ValidateMarkers(input.HighlightPre, input.HighlightPost); err != nil {
+		c.Status(400)
+		return c.SendString("<h2>Error: Invalid highlight markers</h2>")
+	}
 	// Convert checkbox 'on' values to boolean
 	addNew := false
 	if input.AddNew == "on" {
@@ -72,6 +91,19 @@ func DashboardPostHandler(c *fiber.Ctx) error {
 	}
 	settings := &db.SearchSettings{}
 	settings.Amount = input.Amount
+	settings.Concurrency = max(input.Concurrency, 1)
+	settings.HostMaxInFlight = max(input.HostMaxInFlight, 1)
+	settings.HostDelay = input.HostDelay
+	settings.MaxDepth = input.MaxDepth
+	settings.DomainPageBudget = input.DomainPageBudget
+	// A boost of zero ignores matches in that field, negative boosts are not allowed
+	settings.TitleBoost = max(input.TitleBoost, 0)
+	settings.HeadingsBoost = max(input.HeadingsBoost, 0)
+	settings.DescriptionBoost = max(input.DescriptionBoost, 0)
+	settings.UrlBoost = max(input.UrlBoost, 0)
+	settings.BodyBoost = max(input.BodyBoost, 0)
+	settings.HighlightPre = input.HighlightPre
+	settings.HighlightPost = input.HighlightPost
 	settings.SearchOn = searchOn
 	settings.AddNew = addNew
 	err := settings.Update()
@@ -79,10 +111,58 @@ func DashboardPostHandler(c *fiber.Ctx) error {
 		fmt.Println(err)
 		return c.SendString("<h2>Error: Something went wrong</h2>")
 	}
+	// Results cached with the previous boosts and markers are out of date
+	search.SettingsChanged()
 	c.Append("HX-Refresh", "true")
 	return c.SendStatus(200)
 }
 
+type sitemapform struct {
+	Domain string `form:"domain"`
+}
+
+// sitemapImports holds the origins whose sitemaps are being imported, so an origin is only imported once at a time.
+var sitemapImports sync.Map
+
+// SitemapImportHandler is a Fiber handler function that imports the sitemaps of a domain entered on the dashboard view.
+// It checks the domain and starts search.ImportSitemaps in the background, since fetching the sitemaps of a large site takes a while.
+// If the domain is missing or invalid, it responds with a 400 status code and an error message.
+// If the sitemaps of the site are already being imported, it responds with a 409 status code and no new import is started.
+// Otherwise it responds with a message saying the import has started, and the outcome of the import is printed once it finishes.
+//
+// Parameters:
+// c *fiber.Ctx: The context of the request.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the function's execution.
+func SitemapImportHandler(c *fiber.Ctx) error {
+	input := sitemapform{}
+	if err := c.BodyParser(&input); err != nil {
+		c.Status(500)
+		return c.SendString("<h2>Error: Something went wrong</h2>")
+	}
+	origin, err := search.SiteOrigin(input.Domain)
+	if err != nil {
+		c.Status(400)
+		return c.SendString("<h2>Error: Invalid domain</h2>")
+	}
+	if _, running := sitemapImports.LoadOrStore(origin, true); running {
+		c.Status(409)
+		return c.SendString("<h2>The sitemaps of " + html.EscapeString(origin) + " are already being imported</h2>")
+	}
+	go func() {
+		defer sitemapImports.Delete(origin)
+		added, err := search.ImportSitemaps(origin)
+		if err != nil {
+			fmt.Println(err)
+			fmt.Printf("something went wrong importing the sitemaps of %v\n", origin)
+			return
+		}
+		fmt.Printf("\nAdded %d new urls from the sitemaps of %v \n", added, origin)
+	}()
+	return c.SendString("<h2>Importing the sitemaps of " + html.EscapeString(origin) + "</h2>")
+}
+
 func LoginHandler(c *fiber.Ctx) error {
 	return render(c, views.Login())
 }
@@ -1,12 +1,16 @@
 package routes
 
 import (
+	"fiber-search-engine/search"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/a-h/templ"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cache"
+	"github.com/gofiber/fiber/v2/middleware/etag"
 )
 
 // render is a helper function that renders a component and sends the result to the client.
@@ -34,6 +38,41 @@ func render(c *fiber.Ctx, component templ.Component, options ...func(*templ.Comp
 	return adaptor.HTTPHandler(componentHandler)(c)
 }
 
+// searchCacheExpiration is how long a search response is served from the cache.
+const searchCacheExpiration = 30 * time.Minute
+
+// searchCache is a function that returns the cache middleware of the search API.
+// Responses are cached under the path and the query string with its parameters sorted, so the same search asked with its
+// parameters in another order is served from the same entry, along with the versions of the search index and of the search settings,
+// so a response is no longer served once the index changes or the boosts or highlight markers are updated.
+// Requests with the "noCache" query parameter set to "true" skip the cache, and only successful responses are stored.
+// The headers of a response are stored with it, so cached responses still tell clients to revalidate them.
+//
+// This function does not take any parameters.
+//
+// Returns:
+// fiber.Handler: The cache middleware.
+func searchCache() fiber.Handler {
+	return cache.New(cache.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return c.Query("noCache") == "true" || c.Response().StatusCode() != fiber.StatusOK
+		},
+		KeyGenerator: searchCacheKey,
+		Expiration:   searchCacheExpiration,
+		// Responses served from the cache keep the no-cache header of the response, so clients still revalidate them
+		StoreResponseHeaders: true,
+	})
+}
+
+// searchCacheKey returns the key a search response is cached under.
+func searchCacheKey(c *fiber.Ctx) string {
+	key := c.OriginalURL()
+	if query, err := url.ParseQuery(string(c.Request().URI().QueryString())); err == nil {
+		key = c.Path() + "?" + query.Encode()
+	}
+	return strconv.FormatUint(search.IndexVersion(), 10) + ":" + strconv.FormatUint(search.SettingsVersion(), 10) + ":" + key
+}
+
 // SetRoutes is a function that sets up the routes for the Fiber application.
 // It takes a pointer to a Fiber App as a parameter and does not return any values.
 // The routes it sets up are:
@@ -41,23 +80,29 @@ func render(c *fiber.Ctx, component templ.Component, options ...func(*templ.Comp
 // - POST /login: The form submission from the login view
 // - POST /logout: The logout action
 // - POST /search: The search action
+// - GET /api/v1/search: The search action with the query in the query string (cached)
+// - GET /api/v1/suggest: The query suggestions for a prefix
+// - GET /search: The public search page
+// - GET /search/suggest: The query suggestions as options of the search box
 // - GET /: The dashboard view (requires authentication)
 // - POST /: The form submission from the dashboard view (requires authentication)
 //
-// It also sets up a cache middleware for the /search route that caches responses for 30 minutes, unless the "noCache" query parameter is set to "true".
+// The GET search API is served through an ETag middleware, so a client sending back the ETag of a response in If-None-Match
+// gets a 304 when the results have not changed, and through a cache middleware that keeps successful responses
+// for searchCacheExpiration, unless the "noCache" query parameter is set to "true".
+// Searches are recorded by recordSearch in front of the cache, so searches answered from the cache count towards popular queries.
 func SetRoutes(app *fiber.App) {
 	app.Get("/login", LoginHandler)
 	app.Post("/login", LoginPostHandler)
 	app.Post("/logout", LogoutHandler)
 
-	app.Post("/search", HandleSearch)
-	app.Use("/search", cache.New(cache.Config{
-		Next: func(c *fiber.Ctx) bool {
-			return c.Query("noCache") == "true"
-		},
-		Expiration:   30 * time.Minute,
-		CacheControl: true,
-	}))
+	app.Post("/search", recordSearch, HandleSearch)
+	app.Get("/search", SearchPageHandler)
+	app.Get("/search/suggest", SuggestOptionsHandler)
+
+	api := app.Group("/api/v1")
+	api.Get("/search", etag.New(etag.Config{Weak: true}), recordSearch, searchCache(), HandleSearch)
+	api.Get("/suggest", HandleSuggest)
 
 	// app.Get("/create", func(c *fiber.Ctx) error {
 	// 	u := &db.User{}
@@ -67,4 +112,5 @@ func SetRoutes(app *fiber.App) {
 
 	app.Get("/", AuthMiddleware, DashboardHandler)
 	app.Post("/", AuthMiddleware, DashboardPostHandler)
+	app.Post("/sitemaps", AuthMiddleware, SitemapImportHandler)
 }
@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"fiber-search-engine/search"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/etag"
+)
+
+func TestSearchCache(t *testing.T) {
+	calls := 0
+	app := fiber.New()
+	app.Get("/api/v1/search", etag.New(etag.Config{Weak: true}), searchCache(), func(c *fiber.Ctx) error {
+		calls++
+		if c.Query("q") == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		return c.SendString("results for " + c.Query("q"))
+	})
+
+	// Define test cases
+	testCases := []struct {
+		url      string
+		calls    int
+		expected string
+	}{
+		{"/api/v1/search?q=shoes&limit=5", 1, "miss"},
+		// A repeated query is served from the cache, whatever the order of its parameters
+		{"/api/v1/search?q=shoes&limit=5", 1, "hit"},
+		{"/api/v1/search?limit=5&q=shoes", 1, "hit"},
+		{"/api/v1/search?q=boots&limit=5", 2, "miss"},
+		// noCache bypasses the cache
+		{"/api/v1/search?q=shoes&limit=5&noCache=true", 3, "unreachable"},
+		// Failed responses are not cached
+		{"/api/v1/search?q=", 4, "unreachable"},
+		{"/api/v1/search?q=", 5, "unreachable"},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		resp, err := app.Test(httptest.NewRequest("GET", tc.url, nil))
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+
+		// Compare the result with the expected value
+		if calls != tc.calls {
+			t.Errorf("For '%s', expected '%v' handler calls, but got '%v'", tc.url, tc.calls, calls)
+		}
+		if result := resp.Header.Get("X-Cache"); result != tc.expected {
+			t.Errorf("For '%s', expected '%v', but got '%v'", tc.url, tc.expected, result)
+		}
+		// Cached responses still tell clients to revalidate them
+		if resp.StatusCode == fiber.StatusOK && resp.Header.Get(fiber.HeaderCacheControl) != "no-cache" {
+			t.Errorf("For '%s', expected '%v', but got '%v'", tc.url, "no-cache", resp.Header.Get(fiber.HeaderCacheControl))
+		}
+	}
+
+	// A client sending back the ETag of a response gets a 304
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/search?q=shoes&limit=5", nil))
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/api/v1/search?q=shoes&limit=5", nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotModified {
+		t.Errorf("Expected '%v', but got '%v'", fiber.StatusNotModified, resp.StatusCode)
+	}
+
+	// Responses cached before the search settings changed are not served
+	search.SettingsChanged()
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/v1/search?q=shoes&limit=5", nil))
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	if result := resp.Header.Get("X-Cache"); result != "miss" {
+		t.Errorf("Expected '%v', but got '%v'", "miss", result)
+	}
+}
+
+func TestSearchPageHandler(t *testing.T) {
+	app := fiber.New()
+	app.Get("/search", SearchPageHandler)
+
+	// Define test cases
+	testCases := []struct {
+		headers  map[string]string
+		fullPage bool
+	}{
+		{map[string]string{}, true},
+		{map[string]string{"HX-Request": "true"}, false},
+		// A history restore swaps the response in place of the whole page
+		{map[string]string{"HX-Request": "true", "HX-History-Restore-Request": "true"}, true},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "/search", nil)
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+
+		// Compare the result with the expected value
+		if result := strings.Contains(string(body), "<html"); result != tc.fullPage {
+			t.Errorf("For headers '%v', expected a full page '%v', but got '%v'", tc.headers, tc.fullPage, result)
+		}
+		if vary := resp.Header.Get("Vary"); !strings.Contains(vary, "HX-Request") {
+			t.Errorf("For headers '%v', expected the response to vary on HX-Request, but got '%v'", tc.headers, vary)
+		}
+	}
+}
+
+func TestRecordSearch(t *testing.T) {
+	recorded := map[string]int{}
+	recordQuery = func(query string) { recorded[query]++ }
+	defer func() { recordQuery = search.RecordQuery }()
+	app := fiber.New()
+	app.Get("/api/v1/search", recordSearch, searchCache(), func(c *fiber.Ctx) error {
+		if c.Query("q") == "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		total := 0
+		if c.Query("q") == "shoes" {
+			total = 12
+		}
+		return c.JSON(fiber.Map{"success": true, "data": fiber.Map{"total": total, "offset": c.QueryInt("offset")}})
+	})
+
+	// Define test cases
+	testCases := []struct {
+		url      string
+		query    string
+		expected int
+	}{
+		{"/api/v1/search?q=shoes", "shoes", 1},
+		// Searches answered from the cache are counted too
+		{"/api/v1/search?q=shoes", "shoes", 2},
+		// Later pages, searches without results and failed searches are not counted
+		{"/api/v1/search?q=shoes&offset=10", "shoes", 2},
+		{"/api/v1/search?q=boots", "boots", 0},
+		{"/api/v1/search?q=", "", 0},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		if _, err := app.Test(httptest.NewRequest("GET", tc.url, nil)); err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+
+		// Compare the result with the expected value
+		if recorded[tc.query] != tc.expected {
+			t.Errorf("For '%s', expected '%v' searches recorded, but got '%v'", tc.url, tc.expected, recorded[tc.query])
+		}
+	}
+}
@@ -1,19 +1,51 @@
 package routes
 
 import (
-	"fiber-search-engine/db"
+	"encoding/json"
+	"errors"
+	"fiber-search-engine/search"
+	"fiber-search-engine/views"
+	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type searchInput struct {
-	Term string `json:"term"`
+	Term   string `json:"term" query:"q"`
+	Limit  int    `json:"limit" query:"limit"`
+	Offset int    `json:"offset" query:"offset"`
+	Cursor string `json:"cursor" query:"cursor"`
+}
+
+// pageRange returns the offset and limit of the page of results a search input asks for,
+// read from its cursor if it has one, or a message explaining why they are invalid.
+func (input searchInput) pageRange() (int, int, string) {
+	offset, limit := input.Offset, input.Limit
+	if input.Cursor != "" {
+		var err error
+		offset, limit, err = search.DecodeCursor(input.Cursor, input.Term)
+		if err != nil {
+			return 0, 0, "Invalid cursor"
+		}
+	}
+	if offset < 0 || limit < 0 {
+		return 0, 0, "Invalid limit or offset"
+	}
+	return offset, limit, ""
 }
 
 // HandleSearch is a Fiber handler function that processes the search request.
-// It parses the request body into a searchInput struct and performs a full-text search on the SearchIndex table in the database.
+// It parses the request body of a POST, or the q, limit, offset and cursor parameters of the query string of a GET,
+// into a searchInput struct and performs a full-text search on the search index.
 // If there is an error parsing the request body, the search term is empty, or there is an error performing the search, it responds with a 500 status code and an error message.
-// If the search is successful, it responds with a 200 status code and the search results.
+// If the search term is not a valid query, it responds with a 400 status code and an errors list describing what is wrong and where.
+// If the search is successful, it responds with a 200 status code and a page of the search results, best match first.
+// Each result holds the url, title and description of the page, its BM25 score, and a snippet with the matched terms highlighted.
+// The page holds at most limit results, capped at search.MaxPageSize, starting at offset, along with the total number of matches.
+// The nextCursor of a page can be sent back as cursor with the same term to get the next page, in which case limit and offset are ignored.
+// A negative limit or offset, or a cursor issued for another term, is answered with a 400 status code.
+// Successful responses to a GET carry a Cache-Control: no-cache header, so clients and proxies revalidate them with their ETag
+// every time and never keep results from before a reindex.
 //
 // Parameters:
 // c *fiber.Ctx: The context of the request.
@@ -22,7 +54,11 @@ type searchInput struct {
 // error: An error object that describes an error that occurred during the function's execution.
 func HandleSearch(c *fiber.Ctx) error {
 	input := searchInput{}
-	if err := c.BodyParser(&input); err != nil {
+	parse := c.BodyParser
+	if c.Method() == fiber.MethodGet {
+		parse = c.QueryParser
+	}
+	if err := parse(&input); err != nil {
 		c.Status(500)
 		c.Append("content-type", "application/json")
 		return c.JSON(fiber.Map{
@@ -40,8 +76,28 @@ func HandleSearch(c *fiber.Ctx) error {
 			"data":    nil,
 		})
 	}
-	idx := &db.SearchIndex{}
-	data, err := idx.FullTextSearch(input.Term)
+	offset, limit, message := input.pageRange()
+	if message != "" {
+		c.Status(400)
+		c.Append("content-type", "application/json")
+		return c.JSON(fiber.Map{
+			"success": false,
+			"message": message,
+			"data":    nil,
+		})
+	}
+	data, err := search.FullTextSearch(input.Term, offset, limit)
+	var queryErr *search.QueryError
+	if errors.As(err, &queryErr) {
+		c.Status(400)
+		c.Append("content-type", "application/json")
+		return c.JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid query",
+			"data":    nil,
+			"errors":  []*search.QueryError{queryErr},
+		})
+	}
 	if err != nil {
 		c.Status(500)
 		c.Append("content-type", "application/json")
@@ -51,6 +107,9 @@ func HandleSearch(c *fiber.Ctx) error {
 			"data":    nil,
 		})
 	}
+	if c.Method() == fiber.MethodGet {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	}
 	c.Status(200)
 	c.Append("content-type", "application/json")
 	return c.JSON(fiber.Map{
@@ -59,3 +118,133 @@ func HandleSearch(c *fiber.Ctx) error {
 		"data":    data,
 	})
 }
+
+// recordQuery counts a search for a query, replaced in tests.
+var recordQuery = search.RecordQuery
+
+// recordSearch is a Fiber middleware that records the searches answered by HandleSearch, so popular queries are suggested by HandleSuggest.
+// It runs in front of the cache middleware of the search API, so searches answered from the cache are counted too.
+// A search is recorded when the response is successful and holds the first page of a query with results, read from the response body.
+//
+// Parameters:
+// c *fiber.Ctx: The context of the request.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the function's execution.
+func recordSearch(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		return err
+	}
+	if c.Response().StatusCode() != fiber.StatusOK {
+		return nil
+	}
+	input := searchInput{}
+	parse := c.BodyParser
+	if c.Method() == fiber.MethodGet {
+		parse = c.QueryParser
+	}
+	var response struct {
+		Data search.Page `json:"data"`
+	}
+	if parse(&input) != nil || json.Unmarshal(c.Response().Body(), &response) != nil {
+		return nil
+	}
+	if response.Data.Offset == 0 && response.Data.Total > 0 {
+		recordQuery(input.Term)
+	}
+	return nil
+}
+
+// SearchPageHandler is a Fiber handler function that renders the public search page.
+// It reads the query from the q parameter and the page of results from the limit, offset and cursor parameters, the same way as HandleSearch.
+// Requests sent by htmx, which have the HX-Request header, only get the results so they can be swapped into the page,
+// while other requests get the whole page with the results of the query, so search pages can be linked to and reloaded.
+// History restore requests, sent by htmx when Back or Forward lands on a page missing from its history cache, also get the whole page,
+// since htmx swaps their response in place of the page body. The response varies on those headers so caches keep the two apart.
+// An invalid query or page is shown as a message in place of the results.
+//
+// Parameters:
+// c *fiber.Ctx: The context of the request.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the function's execution.
+func SearchPageHandler(c *fiber.Ctx) error {
+	input := searchInput{}
+	page := search.Page{}
+	message := ""
+	if err := c.QueryParser(&input); err != nil {
+		message = "Invalid input"
+	} else if input.Term != "" {
+		var offset, limit int
+		offset, limit, message = input.pageRange()
+		if message == "" {
+			var err error
+			page, err = search.FullTextSearch(input.Term, offset, limit)
+			var queryErr *search.QueryError
+			if errors.As(err, &queryErr) {
+				message = queryErr.Error()
+			} else if err != nil {
+				fmt.Println(err)
+				message = "Something went wrong"
+			}
+		}
+	}
+	// The same url serves the results or the whole page depending on the headers
+	c.Vary("HX-Request", "HX-History-Restore-Request")
+	historyRestore := c.Get("HX-History-Restore-Request") == "true"
+	if c.Get("HX-Request") == "true" && !historyRestore {
+		return render(c, views.SearchResults(input.Term, page, message))
+	}
+	// Results updated while typing or restored by Back and Forward are not searches the user chose, so only whole page loads are recorded
+	if !historyRestore && message == "" && page.Offset == 0 && page.Total > 0 {
+		recordQuery(input.Term)
+	}
+	return render(c, views.SearchPage(input.Term, page, message))
+}
+
+type suggestInput struct {
+	Prefix string `query:"prefix"`
+	Limit  int    `query:"limit"`
+}
+
+// HandleSuggest is a Fiber handler function that completes the start of a query for type-ahead.
+// It reads the prefix and limit parameters of the query string and responds with a 200 status code and up to limit suggestions,
+// capped at search.MaxSuggestions, taken from the words of the indexed pages and from popular past queries, most frequent first.
+// If the query string cannot be parsed or the limit is negative, it responds with a 400 status code and an error message.
+//
+// Parameters:
+// c *fiber.Ctx: The context of the request.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the function's execution.
+func HandleSuggest(c *fiber.Ctx) error {
+	input := suggestInput{}
+	if err := c.QueryParser(&input); err != nil || input.Limit < 0 {
+		c.Status(400)
+		c.Append("content-type", "application/json")
+		return c.JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+	c.Status(200)
+	c.Append("content-type", "application/json")
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Suggestions",
+		"data":    search.Suggest(input.Prefix, input.Limit),
+	})
+}
+
+// SuggestOptionsHandler is a Fiber handler function that renders the suggestions for the query in the q parameter
+// as the options of the datalist of the search box.
+//
+// Parameters:
+// c *fiber.Ctx: The context of the request.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the function's execution.
+func SuggestOptionsHandler(c *fiber.Ctx) error {
+	return render(c, views.SuggestOptions(search.Suggest(c.Query("q"), search.DefaultSuggestions)))
+}
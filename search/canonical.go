@@ -0,0 +1,163 @@
+package search
+
+import (
+	"errors"
+	"fiber-search-engine/db"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// defaultPorts are the ports dropped from the host of a url with the given scheme.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// trackingParams are query parameters that only tell analytics where a visitor came from. They never change the page.
+// Every parameter starting with utm_ is dropped as well.
+var trackingParams = map[string]bool{
+	"gclid": true, "dclid": true, "gbraid": true, "wbraid": true, "fbclid": true, "msclkid": true, "yclid": true,
+	"twclid": true, "igshid": true, "mc_cid": true, "mc_eid": true, "_ga": true, "_gl": true, "_hsenc": true, "_hsmi": true,
+}
+
+// canonicalUrl is a function that normalizes a url so every way of writing the address of a page gives the same string.
+// The scheme and host are lower cased, the default port of the scheme and a trailing dot on the host are removed,
+// and dot-segments such as /a/../b are resolved, with an empty path becoming /. The fragment and the tracking parameters
+// in trackingParams are dropped, and the remaining query parameters are sorted by name. The parameters are kept as they are written,
+// so a parameter that url.ParseQuery would reject, such as one holding a ;, is not lost.
+// Urls are normalized by it before they are saved, so the same page is not stored twice.
+//
+// Parameters:
+// rawUrl string: The absolute url to normalize.
+//
+// Returns:
+// string: The normalized url.
+// error: An error object if the url cannot be parsed or is not an absolute http or https url.
+func canonicalUrl(rawUrl string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("not an absolute http url: " + rawUrl)
+	}
+	// Resolving against an empty reference removes the dot-segments of the path
+	u = u.ResolveReference(&url.URL{})
+	u.Host = canonicalHost(u.Scheme, u.Host)
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.RawQuery = canonicalQuery(u.RawQuery)
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// canonicalQuery drops the empty and tracking parameters of a raw query and sorts the others by name,
+// keeping the order of repeated names. The parameters are not decoded and encoded again, only filtered and sorted.
+func canonicalQuery(rawQuery string) string {
+	type param struct{ name, raw string }
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if lower := strings.ToLower(name); trackingParams[lower] || strings.HasPrefix(lower, "utm_") {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+	sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+	raws := make([]string, len(params))
+	for i, p := range params {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+// canonicalHost lower cases a host and removes the default port of the scheme and a trailing dot.
+func canonicalHost(scheme string, host string) string {
+	host = strings.ToLower(host)
+	hostname, port := host, ""
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		hostname, port = host[:i], host[i+1:]
+	}
+	hostname = strings.TrimSuffix(hostname, ".")
+	if port == "" || port == defaultPorts[scheme] {
+		return hostname
+	}
+	return hostname + ":" + port
+}
+
+// getCanonical is a function that finds the canonical url a page declares with <link rel="canonical" href="...">.
+// The href is resolved against the url of the page and normalized with canonicalUrl.
+//
+// Parameters:
+// node *html.Node: The root HTML node to start the search from.
+// baseUrl *url.URL: The url of the page, to resolve a relative href against.
+//
+// Returns:
+// string: The canonical url of the page, or an empty string if it does not declare a valid one.
+func getCanonical(node *html.Node, baseUrl *url.URL) string {
+	if node == nil {
+		return ""
+	}
+	if node.Type == html.ElementNode && node.Data == "link" {
+		var rel, href string
+		for _, attr := range node.Attr {
+			switch attr.Key {
+			case "rel":
+				rel = attr.Val
+			case "href":
+				href = attr.Val
+			}
+		}
+		for _, value := range strings.Fields(rel) {
+			if strings.EqualFold(value, "canonical") {
+				ref, err := url.Parse(strings.TrimSpace(href))
+				if err != nil || href == "" {
+					return ""
+				}
+				canonical, err := canonicalUrl(baseUrl.ResolveReference(ref).String())
+				if err != nil {
+					return ""
+				}
+				return canonical
+			}
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if canonical := getCanonical(child, baseUrl); canonical != "" {
+			return canonical
+		}
+	}
+	return ""
+}
+
+// representativeUrl returns the url that stands for a crawled page: the canonical url the page declares if it has one,
+// otherwise the normalized form of the url it was crawled at.
+func representativeUrl(crawledUrl string, declared string) string {
+	if declared != "" {
+		return declared
+	}
+	if canonical, err := canonicalUrl(crawledUrl); err == nil {
+		return canonical
+	}
+	return crawledUrl
+}
+
+// canonicalConfirmed reports whether a canonical url declared by a page was itself crawled as a canonical page:
+// it is stored with the ok status, so it was fetched without being redirected and does not point to another canonical url.
+// A declared canonical url is only honored once confirmed, so pages that name each other, or name a url that redirects back to them,
+// are not all left out of the index.
+func canonicalConfirmed(canonical string, getByUrl func(string) (db.CrawledUrl, error)) bool {
+	stored, err := getByUrl(canonical)
+	return err == nil && stored.ID != "" && stored.Status == db.StatusOk
+}
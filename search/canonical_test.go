@@ -0,0 +1,142 @@
+package search
+
+import (
+	"errors"
+	"fiber-search-engine/db"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCanonicalUrl(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		rawUrl   string
+		expected string
+		err      bool
+	}{
+		{"https://x.com", "https://x.com/", false},
+		{"https://x.com/", "https://x.com/", false},
+		{"HTTPS://X.com/?utm_source=a", "https://x.com/", false},
+		{"https://x.com/#top", "https://x.com/", false},
+		{"http://x.com:80/a", "http://x.com/a", false},
+		{"https://x.com:443/a", "https://x.com/a", false},
+		{"https://x.com:8443/a", "https://x.com:8443/a", false},
+		{"https://x.com./a", "https://x.com/a", false},
+		{"https://x.com/a/./b/../c/", "https://x.com/a/c/", false},
+		{"https://x.com/../a", "https://x.com/a", false},
+		{"https://x.com/Path/Case", "https://x.com/Path/Case", false},
+		{"https://x.com/s?b=2&a=1&a=0&fbclid=abc&UTM_Campaign=x", "https://x.com/s?a=1&a=0&b=2", false},
+		{"https://x.com/s?", "https://x.com/s", false},
+		{"https://x.com/s?q=a;b&_ga=1&&id=%7E1", "https://x.com/s?id=%7E1&q=a;b", false},
+		{"https://x.com/s?c&b=&a=1", "https://x.com/s?a=1&b=&c", false},
+		{"https://[::1]:443/a", "https://[::1]/a", false},
+		{"/relative", "", true},
+		{"mailto:info@x.com", "", true},
+		{"ftp://x.com/file", "", true},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result, err := canonicalUrl(tc.rawUrl)
+
+		// Compare the result with the expected value
+		if result != tc.expected || (err != nil) != tc.err {
+			t.Errorf("For '%s', expected '%v' with error '%v', but got '%v' with error '%v'", tc.rawUrl, tc.expected, tc.err, result, err)
+		}
+	}
+}
+
+func TestGetCanonical(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/blog/post?ref=home")
+
+	// Define test cases
+	testCases := []struct {
+		head     string
+		expected string
+	}{
+		{`<link rel="canonical" href="https://example.com/blog/post">`, "https://example.com/blog/post"},
+		{`<link rel="canonical" href="post#comments">`, "https://example.com/blog/post"},
+		{`<link rel="Canonical" href="https://Other.com:443/post?utm_source=x">`, "https://other.com/post"},
+		{`<link rel="stylesheet" href="/style.css"><link rel="canonical" href="/">`, "https://example.com/"},
+		{`<link rel="alternate" href="/feed.xml">`, ""},
+		{`<link rel="canonical" href="">`, ""},
+		{`<link rel="canonical" href="javascript:void(0)">`, ""},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		doc, _ := html.Parse(strings.NewReader("<html><head>" + tc.head + "</head><body></body></html>"))
+		result := getCanonical(doc, baseURL)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("Expected '%v', but got '%v'", tc.expected, result)
+		}
+	}
+}
+
+func TestRepresentativeUrl(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		crawledUrl string
+		declared   string
+		expected   string
+	}{
+		{"https://example.com/", "", "https://example.com/"},
+		{"https://Example.com/?utm_source=a", "", "https://example.com/"},
+		{"https://example.com/print", "https://example.com/article", "https://example.com/article"},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := representativeUrl(tc.crawledUrl, tc.declared)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("Expected '%v', but got '%v'", tc.expected, result)
+		}
+	}
+}
+
+func TestCanonicalConfirmed(t *testing.T) {
+	stored := map[string]db.CrawledUrl{
+		"https://example.com/a":      {ID: "1", Url: "https://example.com/a", Status: db.StatusOk, Success: true},
+		"https://example.com/b":      {ID: "2", Url: "https://example.com/b", Status: db.StatusNotCanonical, CanonicalUrl: "https://example.com/a"},
+		"http://example.com/a":       {ID: "3", Url: "http://example.com/a", Status: db.StatusRedirected, RedirectUrl: "https://example.com/a"},
+		"https://example.com/failed": {ID: "4", Url: "https://example.com/failed", Status: db.StatusFailed},
+	}
+	getByUrl := func(url string) (db.CrawledUrl, error) {
+		if url == "https://example.com/error" {
+			return db.CrawledUrl{}, errors.New("connection refused")
+		}
+		return stored[url], nil
+	}
+
+	// Define test cases
+	testCases := []struct {
+		canonical string
+		expected  bool
+	}{
+		{"https://example.com/a", true},
+		// A canonical url pointing elsewhere, redirecting or failing is not trusted
+		{"https://example.com/b", false},
+		{"http://example.com/a", false},
+		{"https://example.com/failed", false},
+		// Nor is one that was never crawled or cannot be looked up
+		{"https://example.com/new", false},
+		{"https://example.com/error", false},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := canonicalConfirmed(tc.canonical, getByUrl)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For canonical '%s', expected '%v', but got '%v'", tc.canonical, tc.expected, result)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package search
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fiber-search-engine/db"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,8 +17,14 @@ import (
 
 type CrawlData struct {
 	Url          string
+	FinalUrl     string       // The url the response came from once redirects were followed
+	Redirects    db.Redirects // Redirects followed before the final response, first hop first
+	FailReason   string       // Status recorded for a failed crawl when it is more specific than failed
 	Success      bool
+	NotModified  bool // The server answered 304 Not Modified, so the page is unchanged since the last crawl and has no body
 	ResponseCode int
+	Etag         string // ETag response header, sent back in If-None-Match on the next crawl
+	LastModified string // Last-Modified response header, sent back in If-Modified-Since on the next crawl
 	CrawlData    ParsedBody
 }
 
@@ -23,6 +33,9 @@ type ParsedBody struct {
 	PageTitle       string
 	PageDescription string
 	Headings        string
+	BodyText        string
+	Canonical       string // The normalized url of the page's <link rel="canonical">, empty if it has none
+	SimHash         uint64 // Fingerprint of the body text, see simHash
 	Links           Links
 }
 
@@ -31,32 +44,217 @@ type Links struct {
 	External []string
 }
 
+// userAgent is sent with every request the crawler makes so site owners can identify and address it in robots.txt.
+const userAgent = "FiberSearchBot/1.0 (+https://github.com/hoangtv090103/fiber-search-engine)"
+
+// maxRedirects is the largest number of redirects followed to fetch a url.
+const maxRedirects = 5
+
+// Errors returned when the redirects of a url cannot be followed to a page.
+var (
+	errRedirectLoop       = errors.New("redirect loop")
+	errTooManyRedirects   = errors.New("too many redirects")
+	errRedirectDisallowed = errors.New("redirect target disallowed by robots.txt")
+	errRedirectOtherHost  = errors.New("redirect to another host")
+)
+
+// httpClient is shared by every request the crawler makes.
+// It does not follow redirects itself, so fetchIfChanged can record them.
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// fetch sends a GET request for the URL with the crawler's User-Agent header, following the redirects beforeRedirect allows.
+func fetch(rawUrl string, beforeRedirect func(*url.URL) error) (*http.Response, error) {
+	resp, _, err := fetchIfChanged(rawUrl, "", "", beforeRedirect)
+	return resp, err
+}
+
+// politeRedirects is a function that returns the beforeRedirect function of a request made while holding the limiter slot of a host.
+// A redirect is only followed if the robots.txt of its target allows it, and the slot of the current host is swapped for one
+// of the target's host, waiting for its gap and Crawl-delay, so every hop follows the same rules as the first request.
+//
+// Parameters:
+// limiter *hostLimiter: The limiter the slot is held in.
+// host *string: The host whose slot is held. It is updated on every hop, and the caller releases its slot once the request is done.
+//
+// Returns:
+// func(*url.URL) error: The function to pass as beforeRedirect, which returns errRedirectDisallowed for a disallowed target.
+func politeRedirects(limiter *hostLimiter, host *string) func(*url.URL) error {
+	return func(target *url.URL) error {
+		rules := getRobots(target)
+		if !rules.allowed(target) {
+			return errRedirectDisallowed
+		}
+		limiter.release(*host)
+		*host = strings.ToLower(target.Host)
+		limiter.acquire(*host, rules.crawlDelay())
+		return nil
+	}
+}
+
+// sameHostRedirects returns the beforeRedirect function of a request that may only be redirected within the host of a url,
+// for requests such as robots.txt that are made before the rules of another host can be checked.
+func sameHostRedirects(rawUrl string) func(*url.URL) error {
+	host := hostOf(rawUrl)
+	return func(target *url.URL) error {
+		if strings.ToLower(target.Host) != host {
+			return errRedirectOtherHost
+		}
+		return nil
+	}
+}
+
+// fetchIfChanged is a function that sends a GET request for a URL with the crawler's User-Agent header and follows its redirects.
+// The request is made conditional by the validators of an earlier response: If-None-Match is sent when etag is set
+// and If-Modified-Since when lastModified is set. Every redirect answered on the way is recorded, and at most maxRedirects are followed.
+// Before a redirect is followed, beforeRedirect is called with its target, and the redirect is not followed if it returns an error.
+//
+// Parameters:
+// rawUrl string: The URL to fetch.
+// etag string: The ETag header of an earlier response, or an empty string.
+// lastModified string: The Last-Modified header of an earlier response, or an empty string.
+// beforeRedirect func(*url.URL) error: The function that checks and waits for the target of every redirect, or nil to follow them all.
+//
+// Returns:
+// *http.Response: The first response that is not a redirect. The caller must close its body.
+// db.Redirects: The redirects followed, first hop first.
+// error: errRedirectLoop if a redirect leads back to a URL already fetched, errTooManyRedirects if there are more than maxRedirects,
+// the error returned by beforeRedirect, or an error object that describes why a request failed.
+func fetchIfChanged(rawUrl string, etag string, lastModified string, beforeRedirect func(*url.URL) error) (*http.Response, db.Redirects, error) {
+	var redirects db.Redirects
+	current := rawUrl
+	for {
+		req, err := http.NewRequest(http.MethodGet, current, nil)
+		if err != nil {
+			return nil, redirects, err
+		}
+		req.Header.Set("User-Agent", userAgent)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, redirects, err
+		}
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			return resp, redirects, nil
+		}
+		resp.Body.Close()
+		redirects = append(redirects, db.Redirect{Url: current, StatusCode: resp.StatusCode})
+		target, err := req.URL.Parse(location)
+		if err != nil {
+			return nil, redirects, err
+		}
+		current = target.String()
+		for _, redirect := range redirects {
+			if redirect.Url == current {
+				return nil, redirects, errRedirectLoop
+			}
+		}
+		if len(redirects) > maxRedirects {
+			return nil, redirects, errTooManyRedirects
+		}
+		if beforeRedirect != nil {
+			if err := beforeRedirect(target); err != nil {
+				return nil, redirects, err
+			}
+		}
+	}
+}
+
+// isRedirect reports whether a status code asks the client to fetch the url of the Location header instead.
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// movedTo is a function that finds where a url moved to from the redirects followed to fetch it.
+// Only permanent redirects, 301 and 308, move a url: the target is the url reached by the permanent redirects at the start of the chain,
+// so a permanent redirect to a url that redirects temporarily moves the url to that url and not to the final one.
+//
+// Parameters:
+// redirects db.Redirects: The redirects followed, first hop first.
+// finalUrl string: The url of the final response.
+//
+// Returns:
+// string: The url the first url of the chain moved to, or an empty string if it did not move.
+func movedTo(redirects db.Redirects, finalUrl string) string {
+	target := ""
+	for i, redirect := range redirects {
+		if redirect.StatusCode != http.StatusMovedPermanently && redirect.StatusCode != http.StatusPermanentRedirect {
+			break
+		}
+		if i+1 < len(redirects) {
+			target = redirects[i+1].Url
+		} else {
+			target = finalUrl
+		}
+	}
+	return target
+}
+
 // runCrawl is a function that performs a web crawl on a given URL.
-// It sends a GET request to the URL, checks the response for errors, and parses the body if the response is HTML.
+// It sends a GET request to the URL, follows its redirects, checks the response for errors, and parses the body if the response is HTML.
+// The redirects followed are returned with the URL of the final response, and links in the page are resolved against that URL.
+// A redirect loop or a chain of more than maxRedirects redirects fails with the redirect_loop or too_many_redirects reason.
+// Every redirect target is passed to beforeRedirect first, and a target it rejects with errRedirectDisallowed fails with the robots_disallowed reason.
+// The request is conditional when the ETag or Last-Modified header of the last successful crawl is given.
+// If the server answers 304 Not Modified to a conditional request, it returns a CrawlData struct with Success and NotModified set to true and no parsed data.
 // If there is an error sending the request, the response is nil, the status code is not 200, or the content type is not text/html, it returns a CrawlData struct with Success set to false.
-// If the body is successfully parsed, it returns a CrawlData struct with Success set to true and the parsed data.
+// If the body is successfully parsed, it returns a CrawlData struct with Success set to true, the parsed data, and the ETag and Last-Modified headers of the response.
 // The function prints an error message and returns a CrawlData struct with Success set to false if there is an error parsing the body.
 //
 // Parameters:
 // inputUrl string: The URL to perform the web crawl on.
+// etag string: The ETag header of the last successful crawl, or an empty string.
+// lastModified string: The Last-Modified header of the last successful crawl, or an empty string.
+// beforeRedirect func(*url.URL) error: The function that checks and waits for the target of every redirect, or nil to follow them all.
 //
 // Returns:
-// CrawlData: A struct containing the URL, whether the crawl was successful, the response code, and the parsed data from the body.
-func runCrawl(inputUrl string) CrawlData {
-	resp, err := http.Get(inputUrl)
-	baseUrl, _ := url.Parse(inputUrl)
+// CrawlData: A struct containing the URL, the redirects followed, whether the crawl was successful, whether the page was not modified, the response code, the validators and the parsed data from the body.
+func runCrawl(inputUrl string, etag string, lastModified string, beforeRedirect func(*url.URL) error) CrawlData {
+	resp, redirects, err := fetchIfChanged(inputUrl, etag, lastModified, beforeRedirect)
 	// Check for error or if response is empty
 	if err != nil || resp == nil {
 		fmt.Println(err)
 		fmt.Println("something went wrong fetch the body")
-		return CrawlData{Url: inputUrl, Success: false, ResponseCode: 0, CrawlData: ParsedBody{}}
+		result := CrawlData{Url: inputUrl, Redirects: redirects, Success: false, ResponseCode: 0, CrawlData: ParsedBody{}}
+		switch {
+		case errors.Is(err, errRedirectLoop):
+			result.FailReason = db.StatusRedirectLoop
+		case errors.Is(err, errTooManyRedirects):
+			result.FailReason = db.StatusTooManyRedirects
+		case errors.Is(err, errRedirectDisallowed):
+			result.FailReason = db.StatusRobotsDisallowed
+		}
+		if len(redirects) > 0 {
+			result.ResponseCode = redirects[len(redirects)-1].StatusCode
+		}
+		return result
 	}
 	defer resp.Body.Close()
+	baseUrl := resp.Request.URL
+	finalUrl := baseUrl.String()
+	// A page that did not change since the last crawl is not sent again
+	if resp.StatusCode == http.StatusNotModified && (etag != "" || lastModified != "") {
+		return CrawlData{Url: inputUrl, FinalUrl: finalUrl, Redirects: redirects, Success: true, NotModified: true, ResponseCode: resp.StatusCode, Etag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	}
 	// Check if response code is not 200
 	if resp.StatusCode != 200 {
 		fmt.Println(err)
 		fmt.Println("status code is not 200")
-		return CrawlData{Url: inputUrl, Success: false, ResponseCode: resp.StatusCode, CrawlData: ParsedBody{}}
+		return CrawlData{Url: inputUrl, FinalUrl: finalUrl, Redirects: redirects, Success: false, ResponseCode: resp.StatusCode, CrawlData: ParsedBody{}}
 	}
 	// Check the content type is text/html
 	contentType := resp.Header.Get("Content-Type")
@@ -65,19 +263,26 @@ func runCrawl(inputUrl string) CrawlData {
 		data, err := parseBody(resp.Body, baseUrl)
 		if err != nil {
 			fmt.Println("something went wrong getting data from html body")
-			return CrawlData{Url: inputUrl, Success: false, ResponseCode: resp.StatusCode, CrawlData: ParsedBody{}}
+			return CrawlData{Url: inputUrl, FinalUrl: finalUrl, Redirects: redirects, Success: false, ResponseCode: resp.StatusCode, CrawlData: ParsedBody{}}
 		}
-		return CrawlData{Url: inputUrl, Success: true, ResponseCode: resp.StatusCode, CrawlData: data}
+		return CrawlData{Url: inputUrl, FinalUrl: finalUrl, Redirects: redirects, Success: true, ResponseCode: resp.StatusCode, Etag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), CrawlData: data}
 	} else {
 		// response is not HTML
 		fmt.Println("non html response detected")
-		return CrawlData{Url: inputUrl, Success: false, ResponseCode: resp.StatusCode, CrawlData: ParsedBody{}}
+		return CrawlData{Url: inputUrl, FinalUrl: finalUrl, Redirects: redirects, Success: false, ResponseCode: resp.StatusCode, CrawlData: ParsedBody{}}
 	}
 }
 
+// contentHash returns a hash of the content extracted from a page, used to tell whether the page changed between two crawls.
+func contentHash(data ParsedBody) string {
+	sum := sha256.Sum256([]byte(data.PageTitle + "\x00" + data.PageDescription + "\x00" + data.Headings + "\x00" + data.BodyText))
+	return hex.EncodeToString(sum[:])
+}
+
 // parseBody is a function that parses the body of a web page and extracts various information from it.
-// It parses the body into an HTML node tree, extracts all the links, the title and description, and the h1 headings from the tree,
-// and records the time it took to perform these operations.
+// It parses the body into an HTML node tree, extracts all the links, the title and description, the h1 headings, the visible body text
+// and the canonical url the page declares from the tree, and records the time it took to perform these operations.
+// The body text is fingerprinted with simHash, so copies of the page published under other urls can be recognised.
 // The function returns a ParsedBody struct containing the extracted information and the time it took to extract it.
 // If there is an error parsing the body, the function prints an error message and returns an empty ParsedBody struct and the error.
 //
@@ -101,6 +306,12 @@ func parseBody(body io.Reader, baseUrl *url.URL) (ParsedBody, error) {
 	title, desc := getPageData(doc)
 	// Get the H1 tags for the page
 	headings := getPageHeadings(doc)
+	// Get the readable text of the page
+	bodyText := getPageText(doc)
+	// Get the url the page names as its canonical url
+	canonical := getCanonical(doc, baseUrl)
+	// Fingerprint the text to find near-duplicate pages
+	fingerprint := simHash(bodyText)
 
 	// Record timings
 	end := time.Now()
@@ -110,6 +321,9 @@ func parseBody(body io.Reader, baseUrl *url.URL) (ParsedBody, error) {
 		PageTitle:       title,
 		PageDescription: desc,
 		Headings:        headings,
+		BodyText:        bodyText,
+		Canonical:       canonical,
+		SimHash:         fingerprint,
 		Links:           links,
 	}, nil
 }
@@ -117,11 +331,10 @@ func parseBody(body io.Reader, baseUrl *url.URL) (ParsedBody, error) {
 // getLinks is a function that extracts all the internal and external links from a given HTML node and its children.
 // Depth First Search (DFS) of the html tree structure. This is a recursive function to scan the full tree.
 // It uses a recursive function to traverse the HTML node tree and find all anchor tags.
-// The href attribute of each anchor tag is parsed into a URL.
-// If the URL is absolute and has the same host as the base URL, it is considered an internal link.
-// If the URL is absolute and has a different host, it is considered an external link.
-// If the URL is relative, it is resolved against the base URL and considered an internal link.
-// The function ignores URLs that are a hashtag/anchor, mail link, telephone link, javascript link, or a PDF or MD file.
+// The href attribute of each anchor tag is parsed into a URL, resolved against the base URL and normalized with canonicalUrl.
+// If the URL has the same host as the base URL, it is considered an internal link. Otherwise, it is considered an external link.
+// The function ignores URLs that are a hashtag/anchor, mail link, telephone link, javascript link, or a PDF or MD file,
+// and URLs that are not http or https once resolved.
 // The function returns a Links struct containing slices of internal and external links.
 //
 // Parameters:
@@ -135,6 +348,7 @@ func getLinks(node *html.Node, baseUrl *url.URL) Links {
 	if node == nil {
 		return links
 	}
+	base := canonicalHost(strings.ToLower(baseUrl.Scheme), baseUrl.Host)
 	var findLinks func(*html.Node)
 	findLinks = func(node *html.Node) {
 		// Check if the current node is an `html.ElementNode` and if it has a tag name of "a" (i.e., an anchor tag).
@@ -146,16 +360,15 @@ func getLinks(node *html.Node, baseUrl *url.URL) Links {
 					if err != nil || strings.HasPrefix(url.String(), "#") || strings.HasPrefix(url.String(), "mail") || strings.HasPrefix(url.String(), "tel") || strings.HasPrefix(url.String(), "javascript") || strings.HasSuffix(url.String(), ".pdf") || strings.HasSuffix(url.String(), ".md") {
 						continue
 					}
-					// If url is absolute then test if internal or extend before append. Else add the baseUrl append as internal
-					if url.IsAbs() {
-						if isSameHost(url.String(), baseUrl.String()) {
-							links.Internal = append(links.Internal, url.String())
-						} else {
-							links.External = append(links.External, url.String())
-						}
+					// Resolve relative urls against the baseUrl and normalize the result before testing if internal or external
+					link, err := canonicalUrl(baseUrl.ResolveReference(url).String())
+					if err != nil {
+						continue
+					}
+					if hostOf(link) == base {
+						links.Internal = append(links.Internal, link)
 					} else {
-						rel := baseUrl.ResolveReference(url)
-						links.Internal = append(links.Internal, rel.String())
+						links.External = append(links.External, link)
 					}
 				}
 			}
@@ -170,31 +383,6 @@ func getLinks(node *html.Node, baseUrl *url.URL) Links {
 	return links
 }
 
-// isSameHost is a function that checks if two URLs have the same host.
-// It parses both URLs and compares their hosts.
-// If there is an error parsing either URL, it returns false.
-// If the hosts are the same, it returns true. Otherwise, it returns false.
-//
-// Parameters:
-// absoluteURL string: The first URL to compare.
-// baseURL string: The second URL to compare.
-//
-// Returns:
-// bool: True if the hosts of both URLs are the same, false otherwise.
-func isSameHost(absoluteURL string, baseURL string) bool {
-	absURL, err := url.Parse(absoluteURL) // Parse the absolute URL. Example: https://example.com/path => Host: example.com
-	if err != nil {
-		return false
-	}
-
-	baseURLParsed, err := url.Parse(baseURL) // Parse the base URL. Example: https://example.com/path => Host: example.com
-	if err != nil {
-		return false
-	}
-
-	return absURL.Host == baseURLParsed.Host
-}
-
 // getPageData is a function that extracts the title and description from a given HTML node and its children.
 // It uses a recursive function to traverse the HTML node tree and find the title and meta elements.
 // The content of the title element and the content attribute of the meta element with name "description" are returned.
@@ -278,3 +466,71 @@ func getPageHeadings(n *html.Node) string {
 	// Remove the last comma and space from the concatenated string & return
 	return strings.TrimSuffix(headings.String(), ", ")
 }
+
+// maxBodyTextSize is the largest number of bytes of body text kept for a page. Text past the limit is dropped.
+const maxBodyTextSize = 64 * 1024
+
+// skippedTextElements are elements whose text is not part of the readable content of a page,
+// either because it is not displayed or because it is navigation and boilerplate repeated on every page of a site.
+var skippedTextElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "iframe": true, "nav": true, "header": true, "footer": true,
+}
+
+// getPageText is a function that extracts the visible text of the body of a given HTML node.
+// It uses a recursive function to traverse the HTML node tree and collect every text node,
+// skipping the elements in skippedTextElements and elements that are hidden with the hidden attribute or aria-hidden="true".
+// Runs of whitespace are collapsed into a single space, so words in different elements do not run together.
+// The text is cut at the last word that fits in maxBodyTextSize bytes.
+// If the HTML node is nil, it returns an empty string.
+//
+// Parameters:
+// n *html.Node: The root HTML node to start the search from.
+//
+// Returns:
+// string: The visible text of the page.
+func getPageText(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var text strings.Builder
+	var findText func(*html.Node) bool
+	// findText returns false once the size limit is reached to stop the traversal
+	findText = func(n *html.Node) bool {
+		switch n.Type {
+		case html.TextNode:
+			for _, word := range strings.Fields(n.Data) {
+				if text.Len()+len(word)+1 > maxBodyTextSize {
+					return false
+				}
+				if text.Len() > 0 {
+					text.WriteByte(' ')
+				}
+				text.WriteString(word)
+			}
+			return true
+		case html.ElementNode:
+			if skippedTextElements[n.Data] || isHidden(n) {
+				return true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if !findText(c) {
+				return false
+			}
+		}
+		return true
+	}
+	findText(n)
+	return text.String()
+}
+
+// isHidden reports whether an element is marked as not displayed.
+func isHidden(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == "hidden" || (attr.Key == "aria-hidden" && attr.Val == "true") {
+			return true
+		}
+	}
+	return false
+}
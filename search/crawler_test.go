@@ -1,6 +1,10 @@
 package search
 
 import (
+	"fiber-search-engine/db"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
@@ -15,6 +19,7 @@ func TestParseBody(t *testing.T) {
 			<head>
 				<title>Page Title</title>
 				<meta name="description" content="Page Description">
+				<link rel="canonical" href="/?utm_source=feed">
 			</head>
 			<body>
 				<h1>Heading 1</h1>
@@ -30,8 +35,8 @@ func TestParseBody(t *testing.T) {
 	expectedPageTitle := "Page Title"
 	expectedPageDesc := "Page Description"
 	expectedHeadings := "Heading 1"
-	expectedInternalLinks := []string{"https://example.com", "https://example.com/internal"}
-	expectedExternalLinks := []string{"https://external.com"}
+	expectedInternalLinks := []string{"https://example.com/", "https://example.com/internal"}
+	expectedExternalLinks := []string{"https://external.com/"}
 
 	// Call the function
 	result, err := parseBody(body, baseURL)
@@ -56,6 +61,11 @@ func TestParseBody(t *testing.T) {
 		t.Errorf("Expected headings '%s', but got '%s'", expectedHeadings, result.Headings)
 	}
 
+	// Compare the canonical url result with the expected value
+	if result.Canonical != "https://example.com/" {
+		t.Errorf("Expected canonical url '%s', but got '%s'", "https://example.com/", result.Canonical)
+	}
+
 	// Compare the internal links result with the expected value
 	if !equalSlices(result.Links.Internal, expectedInternalLinks) {
 		t.Errorf("Expected internal links '%v', but got '%v'", expectedInternalLinks, result.Links.Internal)
@@ -81,14 +91,17 @@ func TestGetLinks(t *testing.T) {
 				<a href="javascript:void(0)">JavaScript Link</a>
 				<a href="document.pdf">PDF Link</a>
 				<a href="document.md">MD Link</a>
+				<a href="HTTPS://Example.com:443/a/../b?utm_medium=email#top">Tracked Link</a>
+				<a href="//external.com/page">Protocol Relative Link</a>
+				<a href="ftp://example.com/file">FTP Link</a>
 			</body>
 		</html>
 	`))
 
 	baseURL, _ := url.Parse("https://example.com")
 
-	expectedInternal := []string{"https://example.com", "https://example.com/internal"}
-	expectedExternal := []string{"https://external.com"}
+	expectedInternal := []string{"https://example.com/", "https://example.com/internal", "https://example.com/b"}
+	expectedExternal := []string{"https://external.com/", "https://external.com/page"}
 
 	// Call the function
 	result := getLinks(doc, baseURL)
@@ -117,32 +130,6 @@ func equalSlices(a, b []string) bool {
 	return true
 }
 
-func TestIsSameHost(t *testing.T) {
-	// Define test cases
-	testCases := []struct {
-		absoluteURL string
-		baseURL     string
-		expected    bool
-	}{
-		{"https://example.com/path", "https://example.com", true},
-		{"https://example.com/path", "https://www.example.com", false},
-		{"https://example.com", "https://example.com", true},
-		{"https://example.com", "https://example.org", false},
-		{"https://example.com", "http://example.com", true},
-	}
-
-	// Iterate over test cases
-	for _, tc := range testCases {
-		result := isSameHost(tc.absoluteURL, tc.baseURL)
-
-		// Compare the result with the expected value
-		if result != tc.expected {
-			t.Errorf("For absoluteURL '%s' and baseURL '%s', expected '%v', but got '%v'",
-				tc.absoluteURL, tc.baseURL, tc.expected, result)
-		}
-	}
-}
-
 func TestGetPageData(t *testing.T) {
 	// Create a sample HTML node
 	doc, _ := html.Parse(strings.NewReader(`
@@ -200,3 +187,198 @@ func TestGetPageHeadings(t *testing.T) {
 		t.Errorf("Expected '%s', but got '%s'", expected, result)
 	}
 }
+
+func TestGetPageText(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{`<p>Hello <b>world</b></p><p>Second   paragraph</p>`, "Hello world Second paragraph"},
+		{`<head><title>Title</title></head><body><p>Body</p></body>`, "Body"},
+		{`<script>var x = 1;</script><style>p { color: red; }</style><noscript>Enable JavaScript</noscript><p>Visible</p>`, "Visible"},
+		{`<nav><a href="/">Home</a></nav><main>Article text</main><footer>Copyright</footer>`, "Article text"},
+		{`<header>Site name</header><p hidden>Secret</p><span aria-hidden="true">Icon</span><p>Shown</p>`, "Shown"},
+		{``, ""},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		doc, _ := html.Parse(strings.NewReader(tc.html))
+		result := getPageText(doc)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For html '%s', expected '%s', but got '%s'", tc.html, tc.expected, result)
+		}
+	}
+
+	// Text past the size limit is cut at the last whole word
+	doc, _ := html.Parse(strings.NewReader("<p>" + strings.Repeat("word ", maxBodyTextSize) + "</p>"))
+	result := getPageText(doc)
+	if len(result) > maxBodyTextSize || !strings.HasSuffix(result, "word") {
+		t.Errorf("Expected at most %d bytes ending with a whole word, but got %d bytes", maxBodyTextSize, len(result))
+	}
+}
+
+func TestRunCrawlConditional(t *testing.T) {
+	// Create a server that answers 304 when the request carries the current ETag or a recent enough date
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v2"` || r.Header.Get("If-Modified-Since") == "Wed, 01 May 2024 10:00:00 GMT" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v2"`)
+		w.Header().Set("Last-Modified", "Wed, 01 May 2024 10:00:00 GMT")
+		w.Write([]byte("<html><head><title>Page Title</title></head><body>Page body</body></html>"))
+	}))
+	defer server.Close()
+
+	// Define test cases
+	testCases := []struct {
+		etag         string
+		lastModified string
+		notModified  bool
+		title        string
+	}{
+		{"", "", false, "Page Title"},
+		{`"v1"`, "", false, "Page Title"},
+		{`"v2"`, "", true, ""},
+		{"", "Wed, 01 May 2024 10:00:00 GMT", true, ""},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := runCrawl(server.URL, tc.etag, tc.lastModified, nil)
+
+		// Compare the result with the expected value
+		if !result.Success || result.NotModified != tc.notModified || result.CrawlData.PageTitle != tc.title {
+			t.Errorf("Expected a successful crawl with not modified '%v' and title '%v', but got '%v'", tc.notModified, tc.title, result)
+		}
+		if !tc.notModified && (result.Etag != `"v2"` || result.LastModified != "Wed, 01 May 2024 10:00:00 GMT") {
+			t.Errorf("Expected the validators of the response to be returned, but got '%v' and '%v'", result.Etag, result.LastModified)
+		}
+	}
+}
+
+func TestRunCrawlRedirects(t *testing.T) {
+	// Create a server with a redirect chain, a redirect loop and a chain longer than maxRedirects
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/old":
+			http.Redirect(w, r, "/moved", http.StatusFound)
+		case r.URL.Path == "/moved":
+			http.Redirect(w, r, "/new/", http.StatusMovedPermanently)
+		case r.URL.Path == "/new/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>New Page</title></head><body><a href="child">Child</a></body></html>`))
+		case r.URL.Path == "/loop-a":
+			http.Redirect(w, r, "/loop-b", http.StatusMovedPermanently)
+		case r.URL.Path == "/loop-b":
+			http.Redirect(w, r, "/loop-a", http.StatusFound)
+		case strings.HasPrefix(r.URL.Path, "/hop/"):
+			var hop int
+			fmt.Sscanf(r.URL.Path, "/hop/%d", &hop)
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", hop+1), http.StatusTemporaryRedirect)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// The chain is recorded hop by hop and the page is read from the final url
+	result := runCrawl(server.URL+"/old", "", "", nil)
+	expected := db.Redirects{{Url: server.URL + "/old", StatusCode: 302}, {Url: server.URL + "/moved", StatusCode: 301}}
+	if !result.Success || result.FinalUrl != server.URL+"/new/" || result.CrawlData.PageTitle != "New Page" {
+		t.Errorf("Expected a successful crawl of '%v', but got '%v'", server.URL+"/new/", result)
+	}
+	if len(result.Redirects) != len(expected) || result.Redirects[0] != expected[0] || result.Redirects[1] != expected[1] {
+		t.Errorf("Expected '%v', but got '%v'", expected, result.Redirects)
+	}
+	if len(result.CrawlData.Links.Internal) != 1 || result.CrawlData.Links.Internal[0] != server.URL+"/new/child" {
+		t.Errorf("Expected links to be resolved against the final url, but got '%v'", result.CrawlData.Links.Internal)
+	}
+
+	// Define test cases
+	testCases := []struct {
+		path         string
+		failReason   string
+		hops         int
+		responseCode int
+	}{
+		{"/loop-a", db.StatusRedirectLoop, 2, 302},
+		{"/hop/0", db.StatusTooManyRedirects, maxRedirects + 1, 307},
+		{"/missing", "", 0, 404},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := runCrawl(server.URL+tc.path, "", "", nil)
+
+		// Compare the result with the expected value
+		if result.Success || result.FailReason != tc.failReason || len(result.Redirects) != tc.hops || result.ResponseCode != tc.responseCode {
+			t.Errorf("For path '%s', expected a failed crawl with reason '%v' after %d redirects and code %d, but got '%v'", tc.path, tc.failReason, tc.hops, tc.responseCode, result)
+		}
+	}
+}
+
+func TestRunCrawlBeforeRedirect(t *testing.T) {
+	// Create a server with a redirect chain
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/moved", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/private/", http.StatusMovedPermanently)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><head><title>Private</title></head></html>"))
+		}
+	}))
+	defer server.Close()
+
+	// Every target is checked before it is fetched, and a rejected target stops the crawl
+	var checked []string
+	result := runCrawl(server.URL+"/old", "", "", func(target *url.URL) error {
+		checked = append(checked, target.Path)
+		if strings.HasPrefix(target.Path, "/private/") {
+			return errRedirectDisallowed
+		}
+		return nil
+	})
+	expected := []string{"/moved", "/private/"}
+	if !equalSlices(checked, expected) {
+		t.Errorf("Expected '%v', but got '%v'", expected, checked)
+	}
+	if result.Success || result.FailReason != db.StatusRobotsDisallowed || len(result.Redirects) != 2 || result.ResponseCode != 301 {
+		t.Errorf("Expected a failed crawl with reason '%v' after 2 redirects and code 301, but got '%v'", db.StatusRobotsDisallowed, result)
+	}
+}
+
+func TestMovedTo(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		redirects db.Redirects
+		finalUrl  string
+		expected  string
+	}{
+		{nil, "https://example.com/", ""},
+		{db.Redirects{{Url: "http://example.com/", StatusCode: 301}}, "https://example.com/", "https://example.com/"},
+		{db.Redirects{{Url: "https://example.com/old", StatusCode: 308}}, "https://example.com/new", "https://example.com/new"},
+		{db.Redirects{{Url: "https://example.com/", StatusCode: 302}}, "https://example.com/en/", ""},
+		{db.Redirects{{Url: "https://example.com/a", StatusCode: 307}, {Url: "https://example.com/b", StatusCode: 301}}, "https://example.com/c", ""},
+		{db.Redirects{{Url: "http://example.com/a", StatusCode: 301}, {Url: "https://example.com/a", StatusCode: 302}}, "https://example.com/login", "https://example.com/a"},
+		{db.Redirects{{Url: "http://example.com/a", StatusCode: 301}, {Url: "https://example.com/a", StatusCode: 308}}, "https://example.com/b", "https://example.com/b"},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := movedTo(tc.redirects, tc.finalUrl)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For redirects '%v', expected '%s', but got '%s'", tc.redirects, tc.expected, result)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package search
 
 import (
+	"cmp"
 	"fiber-search-engine/db"
 	"fmt"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -10,14 +14,22 @@ import (
 // It first prints a message that the crawl has started and defers a message that the crawl has finished.
 // It then retrieves the crawl settings from the database and checks if search is turned on.
 // If there is an error retrieving the settings or if search is turned off, it prints a message and returns.
-// The function then retrieves the next set of URLs to be crawled from the database.
+// The function then retrieves the next set of due URLs from the crawl frontier in the database.
 // If there is an error retrieving the URLs, it prints a message and returns.
-// The function then loops over the URLs, runs a crawl on each one, and updates the database with the results.
-// If the crawl is not successful, it updates the database with the failed crawl and continues to the next URL.
-// If the crawl is successful, it updates the database with the successful crawl and adds the newly found external URLs to a slice.
-// After all URLs have been crawled, the function checks if it should add the newly found URLs to the database.
-// If it should, it loops over the new URLs and adds each one to the database.
-// If there is an error adding a URL to the database, it prints a message.
+// The function then crawls the URLs with a pool of workers sized by the Concurrency setting.
+// Requests to a single host are limited to HostMaxInFlight at a time and start at least HostDelay milliseconds apart,
+// or further apart if the host's robots.txt asks for a longer Crawl-delay, counting the requests of sitemap imports running at the same time.
+// Each crawl is handled by crawlUrl, which updates the database and returns the links found on the page,
+// and the url that replaces the crawled url when it permanently redirects or is a duplicate of its canonical url, which is queued in its place,
+// or the canonical url the page declares while that url is not confirmed, which is queued so it gets crawled.
+// External links are queued as the entry point of a new site, and internal links are queued one level deeper
+// than the page they were found on until the MaxDepth setting is reached.
+// Every crawl of a site's entry point also reads the site's sitemaps with discoverSitemaps, in a pool of its own running alongside the crawl
+// so slow sitemaps do not hold up the crawl workers. The urls they list are queued one level below the entry point, with a priority taken from the sitemap.
+// After all URLs have been crawled, the function schedules the stored URLs whose sitemap lastmod is after their last crawl to be crawled again now,
+// then checks if it should add the newly found URLs to the database.
+// If it should, it drops the URLs that would take a host over the DomainPageBudget setting and adds the rest to the database.
+// If there is an error adding the URLs to the database, it prints a message.
 // Finally, the function prints a message with the number of new URLs added to the database.
 //
 // This function does not take any parameters and does not return any values.
@@ -43,63 +55,369 @@ func RunEngine() {
 		fmt.Println("something went wrong getting the url list")
 		return
 	}
+	var mu sync.Mutex
 	newUrls := []db.CrawledUrl{}
 	testedTime := time.Now()
-	// Loop over the slice and run crawl on each url
+	// The limiter is shared with sitemap imports, so both count towards the limits of a host
+	limiter := sharedLimiter(*settings)
+	// Read the sitemaps of the sites whose entry point is crawled, alongside the crawl
+	lastMods := map[string]time.Time{}
+	entryPoints := []db.CrawledUrl{}
 	for _, next := range nextUrls {
-		result := runCrawl(next.Url)
-		// Check if the crawl was not successul
-		if !result.Success {
-			// Update row in database with the failed crawl
+		if next.Depth == 0 {
+			entryPoints = append(entryPoints, next)
+		}
+	}
+	var sitemapsRead sync.WaitGroup
+	sitemapsRead.Add(1)
+	go func() {
+		defer sitemapsRead.Done()
+		runPool(entryPoints, int(settings.Concurrency), func(next db.CrawledUrl) {
+			origin, err := SiteOrigin(next.Url)
+			if err != nil {
+				return
+			}
+			fromSitemaps, modified := sitemapFrontier(discoverSitemaps(origin, limiter))
+			mu.Lock()
+			defer mu.Unlock()
+			newUrls = append(newUrls, fromSitemaps...)
+			for u, lastMod := range modified {
+				lastMods[u] = lastMod
+			}
+		})
+	}()
+	// Crawl the urls concurrently and collect the newly found urls
+	runPool(nextUrls, int(settings.Concurrency), func(next db.CrawledUrl) {
+		found, replacement := crawlUrl(next, limiter, testedTime)
+		mu.Lock()
+		defer mu.Unlock()
+		// The target of a permanent redirect or the canonical url of a duplicate page takes its place in the frontier,
+		// and an unconfirmed canonical url is queued to confirm it
+		if replacement != "" {
+			newUrls = append(newUrls, db.CrawledUrl{Url: replacement, Host: hostOf(replacement), Depth: next.Depth, Priority: next.Priority})
+		}
+		// External links are the entry point of a new site
+		for _, newUrl := range found.External {
+			newUrls = append(newUrls, db.CrawledUrl{Url: newUrl, Host: hostOf(newUrl)})
+		}
+		// Internal links are followed until the site's max depth is reached, shallower pages first
+		if next.Depth >= int(settings.MaxDepth) {
+			return
+		}
+		for _, newUrl := range found.Internal {
+			newUrls = append(newUrls, db.CrawledUrl{Url: newUrl, Host: hostOf(newUrl), Depth: next.Depth + 1, Priority: -(next.Depth + 1)})
+		}
+	})
+	sitemapsRead.Wait()
+	// Check if we should add the newly found urls to the database
+	if !settings.AddNew {
+		// The sitemaps still say which stored urls changed since their last crawl
+		if err := crawl.ScheduleModified(lastMods, time.Now()); err != nil {
+			fmt.Println("something went wrong scheduling the urls modified since their last crawl")
+		}
+		fmt.Printf("Adding new urls to database is disabled")
+		return
+	}
+	// Insert newly found urls into database, keeping every host within its page budget
+	added, err := seedFrontier(newUrls, lastMods, int64(settings.DomainPageBudget))
+	if err != nil {
+		fmt.Println("something went wrong adding new urls to database")
+		return
+	}
+	fmt.Printf("\nAdded %d new urls to database \n", added)
+}
+
+// withinPageBudget is a function that drops newly found URLs that would take a host over its page budget.
+// Duplicate URLs and URLs that are already stored are removed first, since they do not add a page to their host,
+// and the rest are kept in the order they were found until a host's budget is used up. A budget of 0 means no limit.
+// If the stored URLs cannot be looked up, every URL is dropped, and if the number of stored URLs for a host cannot be counted, the host's URLs are dropped.
+//
+// Parameters:
+// urls []db.CrawledUrl: The newly found URLs.
+// budget int64: The maximum number of URLs stored for a single host, or 0 for no limit.
+// stored func([]string) (map[string]bool, error): The function that finds which URLs are already stored.
+// countByHost func(string) (int64, error): The function that counts the URLs already stored for a host.
+//
+// Returns:
+// []db.CrawledUrl: The URLs that are not stored yet and fit in their host's budget.
+func withinPageBudget(urls []db.CrawledUrl, budget int64, stored func([]string) (map[string]bool, error), countByHost func(string) (int64, error)) []db.CrawledUrl {
+	seen := map[string]bool{}
+	unique := []db.CrawledUrl{}
+	list := []string{}
+	for _, u := range urls {
+		if seen[u.Url] || u.Host == "" {
+			continue
+		}
+		seen[u.Url] = true
+		unique = append(unique, u)
+		list = append(list, u.Url)
+	}
+	known, err := stored(list)
+	if err != nil {
+		return []db.CrawledUrl{}
+	}
+	remaining := map[string]int64{}
+	result := []db.CrawledUrl{}
+	for _, u := range unique {
+		if known[u.Url] {
+			continue
+		}
+		if budget == 0 {
+			result = append(result, u)
+			continue
+		}
+		left, ok := remaining[u.Host]
+		if !ok {
+			count, err := countByHost(u.Host)
+			if err != nil {
+				count = budget
+			}
+			left = budget - count
+		}
+		if left <= 0 {
+			remaining[u.Host] = 0
+			continue
+		}
+		remaining[u.Host] = left - 1
+		result = append(result, u)
+	}
+	return result
+}
+
+// crawlUrl is a function that crawls a single URL and records the result in the database.
+// Before the URL is fetched the host's robots.txt is checked. Disallowed URLs are not fetched and are recorded with the robots_disallowed status.
+// Otherwise it waits for the host limiter, runs the crawl and updates the database with the result, including the redirects followed to fetch the URL.
+// If the URL permanently redirects (301 or 308) to another URL, nothing is stored under it: it is recorded with the redirected status
+// and the url it moved to, kept out of the index, and the target url is returned so it can be crawled and indexed instead.
+// Temporary redirects are followed and the page is stored under the crawled URL.
+// If the crawl is not successful, it updates the database with the failed crawl and schedules a retry with an exponential backoff.
+// A redirect loop or a chain longer than maxRedirects is recorded with the redirect_loop or too_many_redirects status.
+// Each redirect target is checked against the robots.txt of its host and waits for that host in the limiter before it is fetched,
+// and a redirect to a disallowed url is recorded as a failure with the robots_disallowed status.
+// The request is conditional on the ETag and Last-Modified headers stored by the last successful crawl.
+// If the server answers that the page was not modified, the crawl counts as a successful crawl of unchanged content:
+// the stored content, index entry and canonical url are kept, the next recrawl is scheduled further away, and no links are returned
+// since they were already queued when the page was last downloaded. A stored canonical url that is no longer confirmed is dropped.
+// If the crawl is successful, it updates the database with the successful crawl, schedules the next recrawl based on whether
+// the content changed, and returns the links found on the page.
+// The url that represents the page is the url of its <link rel="canonical">, or the normalized form of the crawled url when it has none.
+// When that is not the crawled url, the page is a duplicate: it is recorded with the not_canonical status and the url of the canonical page,
+// kept out of the index like a failed crawl, and the canonical url is returned so it can be crawled and indexed instead.
+// A declared canonical url is only trusted once canonicalConfirmed finds it was crawled as a canonical page itself.
+// Until then the page is indexed as its own canonical url, and the declared url is returned so it gets crawled.
+//
+// Parameters:
+// next db.CrawledUrl: The URL to crawl.
+// limiter *hostLimiter: The limiter that enforces per-host politeness.
+// testedTime time.Time: The time recorded as the URL's last test.
+//
+// Returns:
+// Links: The internal and external links found on the page.
+// string: The url that replaces the crawled url: where it permanently redirects, or its canonical url when it is a duplicate,
+// or the declared canonical url still to be confirmed, otherwise an empty string.
+func crawlUrl(next db.CrawledUrl, limiter *hostLimiter, testedTime time.Time) (Links, string) {
+	parsed, err := url.Parse(next.Url)
+	if err != nil {
+		fmt.Printf("something went wrong parsing %v\n", next.Url)
+		return Links{}, ""
+	}
+	rules := getRobots(parsed)
+	if !rules.allowed(parsed) {
+		// Record the url as blocked instead of fetching it, and check again once robots.txt may have changed
+		nextCrawl := testedTime.Add(db.DefaultRecrawlInterval)
+		err := next.UpdateUrl(db.CrawledUrl{
+			ID:              next.ID,
+			Url:             next.Url,
+			Success:         false,
+			Status:          db.StatusRobotsDisallowed,
+			LastTested:      &testedTime,
+			NextCrawlAt:     &nextCrawl,
+			RecrawlInterval: next.RecrawlInterval,
+			FailCount:       next.FailCount,
+			ContentHash:     next.ContentHash,
+			SimHash:         next.SimHash,
+			CanonicalUrl:    next.CanonicalUrl,
+			Indexed:         false,
+		})
+		if err != nil {
+			fmt.Println("something went wrong updating a disallowed url")
+		}
+		removeFromIndex(next)
+		return Links{}, ""
+	}
+	host := strings.ToLower(parsed.Host)
+	limiter.acquire(host, rules.crawlDelay())
+	// Redirect targets follow the robots.txt and the limiter of their own host, like the first request
+	result := runCrawl(next.Url, next.Etag, next.LastModified, politeRedirects(limiter, &host))
+	limiter.release(host)
+	// Check if the url moved permanently to another url
+	if result.FailReason == "" {
+		if target, err := canonicalUrl(movedTo(result.Redirects, result.FinalUrl)); err == nil && target != representativeUrl(next.Url, "") {
+			next.ScheduleSuccess(testedTime, false)
+			// Record where the url moved to instead of storing the target's content under it
 			err := next.UpdateUrl(db.CrawledUrl{
 				ID:              next.ID,
 				Url:             next.Url,
 				Success:         false,
-				CrawlDuration:   result.CrawlData.CrawlTime,
-				ResponseCode:    result.ResponseCode,
-				PageTitle:       result.CrawlData.PageTitle,
-				PageDescription: result.CrawlData.PageDescription,
-				Headings:        result.CrawlData.Headings,
+				Status:          db.StatusRedirected,
+				ResponseCode:    result.Redirects[0].StatusCode,
 				LastTested:      &testedTime,
+				NextCrawlAt:     next.NextCrawlAt,
+				RecrawlInterval: next.RecrawlInterval,
+				FailCount:       next.FailCount,
+				ContentHash:     next.ContentHash,
+				SimHash:         next.SimHash,
+				Redirects:       result.Redirects,
+				RedirectUrl:     target,
+				Indexed:         false,
 			})
 			if err != nil {
-				fmt.Println("something went wrong updating a failed url")
+				fmt.Println("something went wrong updating a redirected url")
 			}
-			continue
+			removeFromIndex(next)
+			return Links{}, target
 		}
-		// Update a successful row in database
+	}
+	// Check if the crawl was not successul
+	if !result.Success {
+		// Retry the url later with an exponential backoff
+		next.ScheduleFailure(testedTime)
+		// Update row in database with the failed crawl, dropping the validators along with the content they describe
 		err := next.UpdateUrl(db.CrawledUrl{
 			ID:              next.ID,
 			Url:             next.Url,
-			Success:         result.Success,
+			Success:         false,
+			Status:          cmp.Or(result.FailReason, db.StatusFailed),
 			CrawlDuration:   result.CrawlData.CrawlTime,
 			ResponseCode:    result.ResponseCode,
 			PageTitle:       result.CrawlData.PageTitle,
 			PageDescription: result.CrawlData.PageDescription,
 			Headings:        result.CrawlData.Headings,
+			BodyText:        result.CrawlData.BodyText,
 			LastTested:      &testedTime,
+			NextCrawlAt:     next.NextCrawlAt,
+			RecrawlInterval: next.RecrawlInterval,
+			FailCount:       next.FailCount,
+			ContentHash:     next.ContentHash,
+			SimHash:         next.SimHash,
+			CanonicalUrl:    next.CanonicalUrl,
+			Redirects:       result.Redirects,
+			Indexed:         false,
 		})
 		if err != nil {
-			fmt.Printf("something went wrong updating %v /n", next.Url)
-		}
-		// Push the newly found external urls to an array
-		for _, newUrl := range result.CrawlData.Links.External {
-			newUrls = append(newUrls, db.CrawledUrl{Url: newUrl})
+			fmt.Println("something went wrong updating a failed url")
 		}
-	} // End of range
-	// Check if we should add the newly found urls to the database
-	if !settings.AddNew {
-		fmt.Printf("Adding new urls to database is disabled")
-		return
+		// Stop returning a page that can no longer be fetched
+		removeFromIndex(next)
+		return Links{}, ""
 	}
-	// Insert newly found urls into database
-	for _, newUrl := range newUrls {
-		err := newUrl.Save()
+	// Check if the page did not change since the last crawl
+	if result.NotModified {
+		next.ScheduleSuccess(testedTime, false)
+		// A canonical url that is no longer confirmed stops keeping the page out of the index
+		canonical := next.CanonicalUrl
+		if canonical != "" && !canonicalConfirmed(canonical, next.GetByUrl) {
+			canonical = ""
+		}
+		status := db.StatusOk
+		if canonical != "" {
+			status = db.StatusNotCanonical
+		}
+		// Keep the stored content and index entry, and the validators the server did not send again
+		err := next.UpdateUrl(db.CrawledUrl{
+			ID:              next.ID,
+			Url:             next.Url,
+			Success:         canonical == "",
+			Status:          status,
+			CrawlDuration:   next.CrawlDuration,
+			ResponseCode:    result.ResponseCode,
+			PageTitle:       next.PageTitle,
+			PageDescription: next.PageDescription,
+			Headings:        next.Headings,
+			BodyText:        next.BodyText,
+			LastTested:      &testedTime,
+			NextCrawlAt:     next.NextCrawlAt,
+			RecrawlInterval: next.RecrawlInterval,
+			FailCount:       next.FailCount,
+			ContentHash:     next.ContentHash,
+			SimHash:         next.SimHash,
+			CanonicalUrl:    canonical,
+			Redirects:       result.Redirects,
+			Etag:            cmp.Or(result.Etag, next.Etag),
+			LastModified:    cmp.Or(result.LastModified, next.LastModified),
+			Indexed:         next.Indexed && canonical == "",
+		})
 		if err != nil {
-			fmt.Printf("something went wrong adding new url to database: %v", newUrl.Url)
+			fmt.Printf("something went wrong updating %v\n", next.Url)
 		}
+		return Links{}, ""
+	}
+	// Adapt the recrawl interval to whether the content changed since the last crawl
+	hash := contentHash(result.CrawlData)
+	changed := next.ContentHash != hash
+	next.ScheduleSuccess(testedTime, next.ContentHash != "" && changed)
+	// A page whose canonical url is another url is a duplicate of it, and is kept out of the index
+	canonical := representativeUrl(next.Url, result.CrawlData.Canonical)
+	replacement := ""
+	if canonical != next.Url && result.CrawlData.Canonical != "" && !canonicalConfirmed(canonical, next.GetByUrl) {
+		// The declared canonical url is crawled to confirm it, and the page stays indexed until then
+		replacement = canonical
+		canonical = next.Url
+	}
+	isCanonical := canonical == next.Url
+	status := db.StatusOk
+	if !isCanonical {
+		status = db.StatusNotCanonical
+		replacement = canonical
+	} else {
+		canonical = ""
+	}
+	// Update a successful row in database
+	err = next.UpdateUrl(db.CrawledUrl{
+		ID:              next.ID,
+		Url:             next.Url,
+		Success:         isCanonical,
+		Status:          status,
+		CrawlDuration:   result.CrawlData.CrawlTime,
+		ResponseCode:    result.ResponseCode,
+		PageTitle:       result.CrawlData.PageTitle,
+		PageDescription: result.CrawlData.PageDescription,
+		Headings:        result.CrawlData.Headings,
+		BodyText:        result.CrawlData.BodyText,
+		LastTested:      &testedTime,
+		NextCrawlAt:     next.NextCrawlAt,
+		RecrawlInterval: next.RecrawlInterval,
+		FailCount:       next.FailCount,
+		ContentHash:     hash,
+		SimHash:         int64(result.CrawlData.SimHash),
+		CanonicalUrl:    canonical,
+		Redirects:       result.Redirects,
+		Etag:            result.Etag,
+		LastModified:    result.LastModified,
+		Indexed:         isCanonical && next.Indexed && !changed, // Changed pages are indexed again
+	})
+	if err != nil {
+		fmt.Printf("something went wrong updating %v\n", next.Url)
+	}
+	if !isCanonical {
+		removeFromIndex(next)
+	} else if !changed {
+		// Unchanged pages are not indexed again, so their fingerprint is updated in place
+		memIndex.SetSimHash(next.ID, int64(result.CrawlData.SimHash))
+	}
+	return result.CrawlData.Links, replacement
+}
+
+// removeFromIndex removes a url that could not be crawled from the search index, in memory and in the database.
+// Urls that were never indexed have no postings, so the database is only touched for urls that were.
+func removeFromIndex(doc db.CrawledUrl) {
+	if !memIndex.Remove(doc.ID) && !doc.Indexed {
+		return
+	}
+	searchIndex := &db.SearchIndex{}
+	if err := searchIndex.DeleteUrlPostings([]string{doc.ID}); err != nil {
+		fmt.Println("something went wrong removing a url from the index")
 	}
-	fmt.Printf("\nAdded %d new urls to database \n", len(newUrls))
 }
 
 // RunIndex is a function that runs the search indexing process.
@@ -107,10 +425,11 @@ func RunEngine() {
 // It then retrieves all URLs that have not been indexed from the database.
 // If there is an error retrieving the URLs, it prints a message and returns.
 // The function then creates a new index and adds the not indexed URLs to it.
-// It then saves the index to the database.
+// It then saves the index, with its term frequencies and document lengths, to the database, replacing the earlier postings of URLs that are indexed again.
 // If there is an error saving the index, it prints a message and returns.
-// Finally, it updates the URLs in the database to be indexed=true.
+// It then updates the URLs in the database to be indexed=true, unless they were crawled again since they were read.
 // If there is an error updating the URLs, it prints a message and returns.
+// Finally, once the database is up to date, the indexed URLs are added to the in-memory index that searches are served from.
 //
 // This function does not take any parameters and does not return any values.
 func RunIndex() {
@@ -118,6 +437,7 @@ func RunIndex() {
 	defer fmt.Println("search indexing has finished")
 	// Get index settings from DB
 	crawled := &db.CrawledUrl{}
+	readAt := time.Now()
 	// Get all urls that are not indexed
 	notIndexed, err := crawled.GetNotIndexed()
 	fmt.Println("not indexed urls: ", len(notIndexed))
@@ -126,22 +446,38 @@ func RunIndex() {
 		return
 	}
 	// Create a new index
-	idx := make(Index)
+	idx := NewIndex()
 	// Add the not indexed urls to the index
 	idx.Add(notIndexed)
 	// Save the index to the database
 	searchIndex := &db.SearchIndex{}
-	err = searchIndex.Save(idx, notIndexed)
+	err = searchIndex.Save(idx.Postings, idx.DocLengths)
 	if err != nil {
 		fmt.Println(err)
 		fmt.Println("something went wrong saving the index")
 		return
 	}
 	// Update the urls to be indexed=true
-	err = crawled.SetIndexedTrue(notIndexed)
+	indexedIDs, err := crawled.SetIndexedTrue(notIndexed, readAt)
 	if err != nil {
 		fmt.Println("something went wrong updating the indexed urls")
 		return
 	}
-
+	// Serve the new postings from the in-memory index, leaving out urls crawled again while they were being indexed
+	indexed := make(map[string]bool, len(indexedIDs))
+	for _, id := range indexedIDs {
+		indexed[id] = true
+	}
+	var updated []db.CrawledUrl
+	for _, doc := range notIndexed {
+		if indexed[doc.ID] {
+			updated = append(updated, doc)
+		}
+	}
+	memIndex.Update(updated, idx)
+	// Suggest the words of the new urls and the queries searched for since the last run
+	if err := RefreshSuggestions(); err != nil {
+		fmt.Println(err)
+		fmt.Println("something went wrong refreshing the suggestions")
+	}
 }
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"testing"
+)
+
+func TestWithinPageBudget(t *testing.T) {
+	urls := []db.CrawledUrl{
+		{Url: "https://a.com/1", Host: "a.com"},
+		{Url: "https://a.com/1", Host: "a.com"},
+		{Url: "https://a.com/known", Host: "a.com"},
+		{Url: "https://a.com/2", Host: "a.com"},
+		{Url: "https://a.com/3", Host: "a.com"},
+		{Url: "https://b.com/1", Host: "b.com"},
+		{Url: "https://c.com/1", Host: "c.com"},
+	}
+	// a.com already has 8 urls stored, one of them found again, and c.com is full
+	counts := map[string]int64{"a.com": 8, "c.com": 10}
+	countByHost := func(host string) (int64, error) {
+		return counts[host], nil
+	}
+	stored := func(list []string) (map[string]bool, error) {
+		return map[string]bool{"https://a.com/known": true}, nil
+	}
+
+	// Define test cases
+	testCases := []struct {
+		budget   int64
+		expected []string
+	}{
+		{10, []string{"https://a.com/1", "https://a.com/2", "https://b.com/1"}},
+		{0, []string{"https://a.com/1", "https://a.com/2", "https://a.com/3", "https://b.com/1", "https://c.com/1"}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := []string{}
+		for _, u := range withinPageBudget(urls, tc.budget, stored, countByHost) {
+			result = append(result, u.Url)
+		}
+
+		// Compare the result with the expected value
+		if !equalSlices(result, tc.expected) {
+			t.Errorf("For budget %d, expected '%v', but got '%v'", tc.budget, tc.expected, result)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package search
+
+import "fiber-search-engine/db"
+
+// field identifies a part of a page that is indexed separately so matches in it can be weighted.
+type field int
+
+const (
+	fieldTitle field = iota
+	fieldHeadings
+	fieldDescription
+	fieldUrl
+	fieldBody
+	numFields
+)
+
+// defaultBoosts are the field weights used when the search settings cannot be loaded.
+var defaultBoosts = [numFields]float64{
+	fieldTitle:       3,
+	fieldHeadings:    2,
+	fieldDescription: 1,
+	fieldUrl:         0.5,
+	fieldBody:        1,
+}
+
+// fieldTexts returns the text of every indexed field of a page.
+func fieldTexts(doc db.CrawledUrl) [numFields]string {
+	return [numFields]string{
+		fieldTitle:       doc.PageTitle,
+		fieldHeadings:    doc.Headings,
+		fieldDescription: doc.PageDescription,
+		fieldUrl:         doc.Url,
+		fieldBody:        doc.BodyText,
+	}
+}
+
+// fieldFrequencies returns how often a posting's token appears in every field.
+func fieldFrequencies(p db.Posting) [numFields]int {
+	return [numFields]int{
+		fieldTitle:       p.TitleFrequency,
+		fieldHeadings:    p.HeadingsFrequency,
+		fieldDescription: p.DescriptionFrequency,
+		fieldUrl:         p.UrlFrequency,
+		fieldBody:        p.BodyFrequency,
+	}
+}
+
+// addFieldFrequency adds to the frequency of a posting's token in a field, keeping the total frequency in step.
+func addFieldFrequency(p *db.Posting, f field, n int) {
+	switch f {
+	case fieldTitle:
+		p.TitleFrequency += n
+	case fieldHeadings:
+		p.HeadingsFrequency += n
+	case fieldDescription:
+		p.DescriptionFrequency += n
+	case fieldUrl:
+		p.UrlFrequency += n
+	case fieldBody:
+		p.BodyFrequency += n
+	}
+	p.Frequency += n
+}
+
+// fieldPositions returns the positions of a posting's token in every field.
+func fieldPositions(p db.Posting) [numFields]db.Positions {
+	return [numFields]db.Positions{
+		fieldTitle:       p.TitlePositions,
+		fieldHeadings:    p.HeadingsPositions,
+		fieldDescription: p.DescriptionPositions,
+		fieldUrl:         p.UrlPositions,
+		fieldBody:        p.BodyPositions,
+	}
+}
+
+// addFieldPosition records an occurrence of a posting's token at a position in a field and counts it in the field's frequency.
+// Positions must be added in ascending order.
+func addFieldPosition(p *db.Posting, f field, position int) {
+	switch f {
+	case fieldTitle:
+		p.TitlePositions = append(p.TitlePositions, position)
+	case fieldHeadings:
+		p.HeadingsPositions = append(p.HeadingsPositions, position)
+	case fieldDescription:
+		p.DescriptionPositions = append(p.DescriptionPositions, position)
+	case fieldUrl:
+		p.UrlPositions = append(p.UrlPositions, position)
+	case fieldBody:
+		p.BodyPositions = append(p.BodyPositions, position)
+	}
+	addFieldFrequency(p, f, 1)
+}
+
+// fieldLengths returns the number of tokens indexed in every field of a page.
+func fieldLengths(doc db.CrawledUrl) [numFields]int {
+	return [numFields]int{
+		fieldTitle:       doc.TitleLength,
+		fieldHeadings:    doc.HeadingsLength,
+		fieldDescription: doc.DescriptionLength,
+		fieldUrl:         doc.UrlLength,
+		fieldBody:        doc.BodyLength,
+	}
+}
+
+// toFieldLengths converts field lengths to the form stored on a crawled url.
+func toFieldLengths(lengths [numFields]int) db.FieldLengths {
+	return db.FieldLengths{
+		TitleLength:       lengths[fieldTitle],
+		HeadingsLength:    lengths[fieldHeadings],
+		DescriptionLength: lengths[fieldDescription],
+		UrlLength:         lengths[fieldUrl],
+		BodyLength:        lengths[fieldBody],
+	}
+}
+
+// avgFieldLengths returns the average number of tokens indexed in every field across the collection.
+func avgFieldLengths(stats db.IndexStats) [numFields]float64 {
+	return [numFields]float64{
+		fieldTitle:       stats.AvgTitleLength,
+		fieldHeadings:    stats.AvgHeadingsLength,
+		fieldDescription: stats.AvgDescriptionLength,
+		fieldUrl:         stats.AvgUrlLength,
+		fieldBody:        stats.AvgBodyLength,
+	}
+}
+
+// settingsBoosts returns the field weights configured in the search settings.
+func settingsBoosts(settings db.SearchSettings) [numFields]float64 {
+	return [numFields]float64{
+		fieldTitle:       settings.TitleBoost,
+		fieldHeadings:    settings.HeadingsBoost,
+		fieldDescription: settings.DescriptionBoost,
+		fieldUrl:         settings.UrlBoost,
+		fieldBody:        settings.BodyBoost,
+	}
+}
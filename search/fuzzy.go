@@ -0,0 +1,96 @@
+package search
+
+import "math"
+
+// fuzzyWeight is how much a fuzzy match counts compared with an exact match, for each edit it is away from the search term.
+// It keeps urls matching a fuzzy term exactly above those only matching a close token.
+const fuzzyWeight = 0.3
+
+// fuzzyNode is a fuzzy term whose tokens were looked up in the index. It matches documents containing, for every token
+// of the term, one of the index tokens close to it, optionally only in one field.
+type fuzzyNode struct {
+	field        field
+	alternatives [][]fuzzyToken // The index tokens close to each token of the term
+}
+
+// fuzzyToken is an index token close to a token of a fuzzy term, with the weight of its matches.
+type fuzzyToken struct {
+	token  string
+	weight float64
+}
+
+// expandFuzzy is a method on the MemIndex struct that looks up the index tokens close to the fuzzy terms of a parsed query.
+// It returns a copy of the query where every term written as word~edits is replaced by a fuzzyNode holding, for each token of the word,
+// the tokens of the index within edits edits of it. They are found by walking the trie of index tokens, computing the edit distance
+// along the way and leaving a branch as soon as it is too far, rather than comparing the term with every token.
+// A token at distance d from the term is weighted fuzzyWeight to the power of d, so an exact match keeps its full weight.
+//
+// Parameters:
+// node queryNode: The root of the parsed query.
+//
+// Returns:
+// queryNode: The root of the query with its fuzzy terms expanded.
+func (m *MemIndex) expandFuzzy(node queryNode) queryNode {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.expand(node)
+}
+
+// expand replaces the fuzzy terms below a query node. The caller must hold a read lock.
+func (m *MemIndex) expand(node queryNode) queryNode {
+	switch n := node.(type) {
+	case *termNode:
+		if n.edits == 0 {
+			return n
+		}
+		fuzzy := &fuzzyNode{field: n.field}
+		for _, token := range analyze(n.text) {
+			var alternatives []fuzzyToken
+			for _, match := range m.tokens.within(token, n.edits) {
+				alternatives = append(alternatives, fuzzyToken{token: match.Text, weight: math.Pow(fuzzyWeight, float64(match.distance))})
+			}
+			fuzzy.alternatives = append(fuzzy.alternatives, alternatives)
+		}
+		return fuzzy
+	case *andNode:
+		children := make([]queryNode, len(n.children))
+		for i, child := range n.children {
+			children[i] = m.expand(child)
+		}
+		return &andNode{children: children}
+	case *orNode:
+		children := make([]queryNode, len(n.children))
+		for i, child := range n.children {
+			children[i] = m.expand(child)
+		}
+		return &orNode{children: children}
+	case *notNode:
+		return &notNode{child: m.expand(n.child)}
+	}
+	return node
+}
+
+// matchFuzzy returns the candidate urls containing one of the alternatives of every token of a fuzzy term,
+// in the given field unless it is fieldAny.
+func (ctx *queryContext) matchFuzzy(n *fuzzyNode) docSet {
+	result := docSet{}
+	for id := range ctx.docs {
+		result[id] = struct{}{}
+	}
+	for _, alternatives := range n.alternatives {
+		for id := range result {
+			found := false
+			for _, alternative := range alternatives {
+				posting, ok := ctx.postings[alternative.token][id]
+				if ok && (n.field == fieldAny || fieldFrequencies(posting)[n.field] > 0) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				delete(result, id)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"testing"
+)
+
+func TestFuzzyRanking(t *testing.T) {
+	m := NewMemIndex()
+	docs := []db.CrawledUrl{
+		{ID: "1", Url: "https://example.com/boat", PageTitle: "Boat trips", PageDescription: "Boat trips on the lake, boat hire"},
+		{ID: "2", Url: "https://example.org/boot", PageTitle: "Boot camp"},
+		{ID: "3", Url: "https://example.net/bolt", PageTitle: "Bolt cutters"},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	m.Update(docs, idx)
+
+	// Define test cases
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		// Exact matches rank above fuzzy matches, even when the fuzzy match is more frequent
+		{"boot~1", []string{"2", "1", "3"}},
+		{"boot~0", []string{"2"}},
+		{"bolt~1", []string{"3", "1", "2"}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		root, err := parseQuery(tc.query)
+		if err != nil {
+			t.Errorf("For query '%s', unexpected error: %v", tc.query, err)
+			continue
+		}
+		result := []string{}
+		for _, r := range m.search(m.expandFuzzy(root), defaultBoosts) {
+			result = append(result, r.doc.ID)
+		}
+
+		// Compare the result with the expected value
+		if !equalSlices(result, tc.expected) {
+			t.Errorf("For query '%s', expected '%v', but got '%v'", tc.query, tc.expected, result)
+		}
+	}
+}
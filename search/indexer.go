@@ -2,29 +2,51 @@ package search
 
 import "fiber-search-engine/db"
 
-// Index is an in-memory inverted index. It maps tokens to url IDs.
-type Index map[string][]string
+// Index is an in-memory inverted index. It maps tokens to the postings of the urls they appear on,
+// and records the field lengths of every url it has seen.
+type Index struct {
+	Postings   map[string][]db.Posting    // Token to the urls it appears on and where in each field
+	DocLengths map[string]db.FieldLengths // Url ID to the number of tokens indexed in each field
+}
+
+// NewIndex returns an empty Index.
+func NewIndex() *Index {
+	return &Index{
+		Postings:   map[string][]db.Posting{},
+		DocLengths: map[string]db.FieldLengths{},
+	}
+}
 
 // Add is a method of the Index struct that adds a slice of CrawledUrl documents to the index.
 // Adds documents to the Index.
-// It loops over the documents and for each one, it analyzes the URL, page title, page description, and headings.
-// For each token produced by the analysis, it checks if the document ID is already in the index for that token.
-// If the document ID is not already in the index for that token, it adds the ID to the index.
-// If the document ID is already in the index for that token, it does not add the ID again.
+// It loops over the documents and for each one, it analyzes the page title, headings, page description, URL, and body text as separate fields.
+// It records where each token produced by the analysis appears in each field and adds one posting per token
+// holding the document ID, those positions and the term frequencies. The number of tokens in each field is recorded as the field length.
+// A document added more than once replaces its earlier field lengths but gets a posting per call.
 //
 // Parameters:
 // docs []db.CrawledUrl: A slice of CrawledUrl documents to add to the index.
 //
 // This method does not return any values.
-func (idx Index) Add(docs []db.CrawledUrl) {
+func (idx *Index) Add(docs []db.CrawledUrl) {
 	for _, doc := range docs {
-		for _, token := range analyze(doc.Url + " " + doc.PageTitle + " " + doc.PageDescription + " " + doc.Headings) {
-			ids := idx[token]
-			if ids != nil && ids[len(ids)-1] == doc.ID {
-				// Don't add same ID twice.
-				continue
+		postings := map[string]*db.Posting{}
+		var lengths [numFields]int
+		for f, text := range fieldTexts(doc) {
+			tokens, positions := analyzePositions(text)
+			lengths[f] = len(tokens)
+			for i, token := range tokens {
+				posting, ok := postings[token]
+				if !ok {
+					posting = &db.Posting{CrawledUrlID: doc.ID}
+					postings[token] = posting
+				}
+				addFieldPosition(posting, field(f), positions[i])
 			}
-			idx[token] = append(ids, doc.ID)
+		}
+		idx.DocLengths[doc.ID] = toFieldLengths(lengths)
+		for token, posting := range postings {
+			idx.Postings[token] = append(idx.Postings[token], *posting)
 		}
 	}
 }
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"testing"
+)
+
+func TestIndexAdd(t *testing.T) {
+	idx := NewIndex()
+	idx.Add([]db.CrawledUrl{
+		{ID: "1", Url: "https://example.com", PageTitle: "Running shoes", PageDescription: "Shoes for running and walking"},
+		{ID: "2", Url: "https://example.org", PageTitle: "Walking", Headings: "Walk the dog", BodyText: "Dogs love a long walk"},
+	})
+
+	// Compare the field lengths with the expected values
+	expectedLengths := db.FieldLengths{TitleLength: 2, HeadingsLength: 0, DescriptionLength: 3, UrlLength: 1}
+	if idx.DocLengths["1"] != expectedLengths {
+		t.Errorf("Expected field lengths '%v', but got '%v'", expectedLengths, idx.DocLengths["1"])
+	}
+	expectedLengths = db.FieldLengths{TitleLength: 1, HeadingsLength: 2, DescriptionLength: 0, UrlLength: 1, BodyLength: 4}
+	if idx.DocLengths["2"] != expectedLengths {
+		t.Errorf("Expected field lengths '%v', but got '%v'", expectedLengths, idx.DocLengths["2"])
+	}
+
+	// Compare the postings of a token with the expected values
+	postings := idx.Postings["run"]
+	if len(postings) != 1 || postings[0].CrawledUrlID != "1" || postings[0].Frequency != 2 {
+		t.Errorf("Expected a single posting for url '1' with frequency 2, but got '%v'", postings)
+	}
+	if postings[0].TitleFrequency != 1 || postings[0].DescriptionFrequency != 1 {
+		t.Errorf("Expected the token once in the title and once in the description, but got '%v'", postings[0])
+	}
+	postings = idx.Postings["walk"]
+	if len(postings) != 2 {
+		t.Errorf("Expected 2 postings, but got '%v'", postings)
+	}
+	for _, posting := range postings {
+		if posting.CrawledUrlID == "2" && (posting.HeadingsFrequency != 1 || posting.BodyFrequency != 1) {
+			t.Errorf("Expected the token once in the headings and once in the body, but got '%v'", posting)
+		}
+	}
+}
+
+func TestIndexAddPositions(t *testing.T) {
+	idx := NewIndex()
+	idx.Add([]db.CrawledUrl{
+		{ID: "1", Url: "https://example.com", PageTitle: "Run, run and run again", Headings: "Why we run"},
+	})
+
+	// Compare the positions of a token with the expected values
+	postings := idx.Postings["run"]
+	if len(postings) != 1 {
+		t.Fatalf("Expected a single posting, but got '%v'", postings)
+	}
+	expected := db.Positions{0, 1, 3}
+	if !equalPositions(postings[0].TitlePositions, expected) {
+		t.Errorf("Expected title positions '%v', but got '%v'", expected, postings[0].TitlePositions)
+	}
+	expected = db.Positions{2}
+	if !equalPositions(postings[0].HeadingsPositions, expected) {
+		t.Errorf("Expected headings positions '%v', but got '%v'", expected, postings[0].HeadingsPositions)
+	}
+	if postings[0].TitleFrequency != 3 || postings[0].HeadingsFrequency != 1 || postings[0].Frequency != 4 {
+		t.Errorf("Expected frequencies to match the positions, but got '%v'", postings[0])
+	}
+}
+
+func equalPositions(a, b db.Positions) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
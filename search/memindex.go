@@ -0,0 +1,243 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"sync"
+)
+
+// MemIndex is a long-lived inverted index held in memory and shared by every search.
+// It is built from the database when the server starts and updated after every indexing run,
+// while Postgres stays the source of truth. It is safe for concurrent use: searches hold a read lock
+// for as long as they read the index, and updates hold the write lock.
+type MemIndex struct {
+	mu           sync.RWMutex
+	postings     map[string]map[string]db.Posting // Token to url ID to posting
+	docs         map[string]db.CrawledUrl         // Indexed urls by ID
+	docTokens    map[string][]string              // Url ID to the tokens it has postings for
+	lengthTotals [numFields]int                   // Sum of the field lengths of every indexed url
+	tokens       *trie                            // Every token with postings, to find the tokens close to a fuzzy term
+	version      uint64                           // Incremented on every change, so cached search results can be told apart
+}
+
+// memIndex is the index searches are served from.
+var memIndex = NewMemIndex()
+
+// NewMemIndex returns an empty MemIndex.
+func NewMemIndex() *MemIndex {
+	return &MemIndex{
+		postings:  map[string]map[string]db.Posting{},
+		docs:      map[string]db.CrawledUrl{},
+		docTokens: map[string][]string{},
+		tokens:    newTrie(0),
+	}
+}
+
+// LoadIndex is a function that builds the in-memory search index from the indexed urls and their postings in the database.
+// It should be called once the database is initialised and before the server starts answering searches.
+// The index is built aside and swapped in when complete, so searches running meanwhile see the previous index.
+// The search suggestions are then built from the loaded index.
+//
+// This function does not take any parameters.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the function's execution.
+func LoadIndex() error {
+	if err := memIndex.Load(); err != nil {
+		return err
+	}
+	return RefreshSuggestions()
+}
+
+// Load is a method on the MemIndex struct that replaces the contents of the index with the indexed urls and postings stored in the database.
+// Postings of urls that are not indexed are left out.
+//
+// This method does not take any parameters.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the method's execution.
+func (m *MemIndex) Load() error {
+	crawled := &db.CrawledUrl{}
+	urls, err := crawled.GetIndexed()
+	if err != nil {
+		return err
+	}
+	loaded := NewMemIndex()
+	for _, url := range urls {
+		loaded.addDoc(url)
+	}
+	searchIndex := &db.SearchIndex{}
+	err = searchIndex.EachPosting(func(value string, posting db.Posting) {
+		if _, ok := loaded.docs[posting.CrawledUrlID]; ok {
+			loaded.addPosting(value, posting)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.postings = loaded.postings
+	m.docs = loaded.docs
+	m.docTokens = loaded.docTokens
+	m.lengthTotals = loaded.lengthTotals
+	m.tokens = loaded.tokens
+	m.version++
+	return nil
+}
+
+// Update is a method on the MemIndex struct that adds freshly indexed urls to the index.
+// The earlier postings of a url that is already in the index are removed first, so its tokens are replaced rather than merged.
+// The field lengths of each url are taken from the index it was added to.
+//
+// Parameters:
+// docs []db.CrawledUrl: The urls that were indexed.
+// idx *Index: The index the urls were added to, holding their postings and field lengths.
+//
+// This method does not return any values.
+func (m *MemIndex) Update(docs []db.CrawledUrl, idx *Index) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range docs {
+		m.removeDoc(doc.ID)
+		if lengths, ok := idx.DocLengths[doc.ID]; ok {
+			doc.FieldLengths = lengths
+			doc.DocLength = lengths.Total()
+		}
+		doc.Indexed = true
+		m.addDoc(doc)
+	}
+	for token, postings := range idx.Postings {
+		for _, posting := range postings {
+			if _, ok := m.docs[posting.CrawledUrlID]; ok {
+				m.addPosting(token, posting)
+			}
+		}
+	}
+	m.version++
+}
+
+// Remove is a method on the MemIndex struct that removes a url and all its postings from the index.
+//
+// Parameters:
+// id string: The ID of the url to remove.
+//
+// Returns:
+// bool: Whether the url was in the index.
+func (m *MemIndex) Remove(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.docs[id]
+	if ok {
+		m.removeDoc(id)
+		m.version++
+	}
+	return ok
+}
+
+// SetSimHash is a method on the MemIndex struct that updates the fingerprint of an indexed url whose content did not change.
+// Unchanged urls are not indexed again, so this keeps the fingerprint used to collapse near-duplicate results up to date,
+// for example for urls indexed before fingerprints were stored.
+//
+// Parameters:
+// id string: The ID of the url.
+// simHash int64: The fingerprint of the url's content.
+//
+// This method does not return any values.
+func (m *MemIndex) SetSimHash(id string, simHash int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.docs[id]
+	if !ok || doc.SimHash == simHash {
+		return
+	}
+	doc.SimHash = simHash
+	m.docs[id] = doc
+	m.version++
+}
+
+// IndexVersion is a function that returns the version of the in-memory search index.
+// The version changes whenever urls are loaded into, added to or removed from the index, so search results
+// cached under one version may be out of date once it changes.
+//
+// This function does not take any parameters.
+//
+// Returns:
+// uint64: The version of the index.
+func IndexVersion() uint64 {
+	return memIndex.Version()
+}
+
+// Version is a method on the MemIndex struct that returns the number of changes made to the index.
+//
+// This method does not take any parameters.
+//
+// Returns:
+// uint64: The version of the index.
+func (m *MemIndex) Version() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.version
+}
+
+// addDoc adds a url to the index without postings. The caller must hold the write lock.
+func (m *MemIndex) addDoc(doc db.CrawledUrl) {
+	m.docs[doc.ID] = doc
+	for f, length := range fieldLengths(doc) {
+		m.lengthTotals[f] += length
+	}
+}
+
+// addPosting records the posting of a token. The caller must hold the write lock.
+func (m *MemIndex) addPosting(token string, posting db.Posting) {
+	byDoc, ok := m.postings[token]
+	if !ok {
+		byDoc = map[string]db.Posting{}
+		m.postings[token] = byDoc
+		m.tokens.insert(token, 0)
+	}
+	byDoc[posting.CrawledUrlID] = posting
+	m.docTokens[posting.CrawledUrlID] = append(m.docTokens[posting.CrawledUrlID], token)
+}
+
+// removeDoc removes a url and all its postings from the index. The caller must hold the write lock.
+func (m *MemIndex) removeDoc(id string) {
+	doc, ok := m.docs[id]
+	if !ok {
+		return
+	}
+	for _, token := range m.docTokens[id] {
+		delete(m.postings[token], id)
+		if len(m.postings[token]) == 0 {
+			delete(m.postings, token)
+			m.tokens.remove(token)
+		}
+	}
+	for f, length := range fieldLengths(doc) {
+		m.lengthTotals[f] -= length
+	}
+	delete(m.docTokens, id)
+	delete(m.docs, id)
+}
+
+// stats returns the collection statistics used for ranking. The caller must hold a read lock.
+func (m *MemIndex) stats() db.IndexStats {
+	stats := db.IndexStats{Count: int64(len(m.docs))}
+	if stats.Count == 0 {
+		return stats
+	}
+	avg := func(total int) float64 {
+		return float64(total) / float64(stats.Count)
+	}
+	stats.AvgTitleLength = avg(m.lengthTotals[fieldTitle])
+	stats.AvgHeadingsLength = avg(m.lengthTotals[fieldHeadings])
+	stats.AvgDescriptionLength = avg(m.lengthTotals[fieldDescription])
+	stats.AvgUrlLength = avg(m.lengthTotals[fieldUrl])
+	stats.AvgBodyLength = avg(m.lengthTotals[fieldBody])
+	total := 0
+	for _, length := range m.lengthTotals {
+		total += length
+	}
+	stats.AvgDocLength = avg(total)
+	return stats
+}
@@ -0,0 +1,135 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"testing"
+)
+
+func TestMemIndexUpdate(t *testing.T) {
+	m := NewMemIndex()
+	docs := []db.CrawledUrl{
+		{ID: "1", Url: "https://example.com", PageTitle: "Running shoes"},
+		{ID: "2", Url: "https://example.org", PageTitle: "Walking boots"},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	m.Update(docs, idx)
+
+	// The postings and field lengths of the urls are in the index
+	if _, ok := m.postings["shoe"]["1"]; !ok {
+		t.Errorf("Expected a posting of 'shoe' for url '1', but got '%v'", m.postings["shoe"])
+	}
+	if m.docs["1"].TitleLength != 2 || m.docs["1"].DocLength != 3 || !m.docs["1"].Indexed {
+		t.Errorf("Expected the field lengths of url '1' to be updated, but got '%v'", m.docs["1"])
+	}
+	stats := m.stats()
+	if stats.Count != 2 || stats.AvgTitleLength != 2 || stats.AvgDocLength != 3 {
+		t.Errorf("Expected 2 urls with an average title length of 2, but got '%v'", stats)
+	}
+
+	// Updating a url replaces its postings
+	changed := []db.CrawledUrl{{ID: "1", Url: "https://example.com", PageTitle: "Trail running jackets"}}
+	idx = NewIndex()
+	idx.Add(changed)
+	m.Update(changed, idx)
+	if _, ok := m.postings["shoe"]; ok {
+		t.Errorf("Expected the postings of 'shoe' to be removed, but got '%v'", m.postings["shoe"])
+	}
+	if _, ok := m.postings["jacket"]["1"]; !ok {
+		t.Errorf("Expected a posting of 'jacket' for url '1', but got '%v'", m.postings["jacket"])
+	}
+	if _, ok := m.postings["boot"]["2"]; !ok {
+		t.Errorf("Expected the postings of url '2' to be kept, but got '%v'", m.postings["boot"])
+	}
+	stats = m.stats()
+	if stats.Count != 2 || stats.AvgTitleLength != 2.5 {
+		t.Errorf("Expected 2 urls with an average title length of 2.5, but got '%v'", stats)
+	}
+}
+
+func TestMemIndexSearch(t *testing.T) {
+	m := NewMemIndex()
+	docs := []db.CrawledUrl{
+		{ID: "1", Url: "https://example.com/shoes", PageTitle: "Running shoes", PageDescription: "Shoes for running on the road"},
+		{ID: "2", Url: "https://example.org/blog", PageTitle: "Blog", PageDescription: "We talk about shoes, boots and sometimes running"},
+		{ID: "3", Url: "https://example.net", PageTitle: "Walking boots"},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	m.Update(docs, idx)
+
+	// Define test cases
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{"running shoes", []string{"1", "2"}},
+		{"boots", []string{"3", "2"}},
+		{"shoes -blog", []string{"1"}},
+		{"sandals", []string{}},
+		// Fuzzy terms match the tokens within the number of edits
+		{"shoez", []string{}},
+		{"shoez~1", []string{"1", "2"}},
+		{"bots~1 -title:boots~1", []string{"2"}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		root, err := parseQuery(tc.query)
+		if err != nil {
+			t.Errorf("For query '%s', unexpected error: %v", tc.query, err)
+			continue
+		}
+		result := []string{}
+		for _, r := range m.search(m.expandFuzzy(root), defaultBoosts) {
+			result = append(result, r.doc.ID)
+		}
+
+		// Compare the result with the expected value
+		if !equalSlices(result, tc.expected) {
+			t.Errorf("For query '%s', expected '%v', but got '%v'", tc.query, tc.expected, result)
+		}
+	}
+}
+
+func TestMemIndexRemove(t *testing.T) {
+	m := NewMemIndex()
+	docs := []db.CrawledUrl{
+		{ID: "1", Url: "https://example.com", PageTitle: "Running shoes"},
+		{ID: "2", Url: "https://example.org", PageTitle: "Running boots"},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	m.Update(docs, idx)
+
+	version := m.Version()
+
+	// Removing a url drops its postings and keeps those of other urls
+	if !m.Remove("1") {
+		t.Error("Expected url '1' to be in the index")
+	}
+	if _, ok := m.postings["shoe"]; ok {
+		t.Errorf("Expected the postings of 'shoe' to be removed, but got '%v'", m.postings["shoe"])
+	}
+	if _, ok := m.postings["run"]["1"]; ok {
+		t.Errorf("Expected the posting of 'run' for url '1' to be removed, but got '%v'", m.postings["run"])
+	}
+	if _, ok := m.postings["run"]["2"]; !ok {
+		t.Errorf("Expected the posting of 'run' for url '2' to be kept, but got '%v'", m.postings["run"])
+	}
+	if stats := m.stats(); stats.Count != 1 || stats.AvgTitleLength != 2 {
+		t.Errorf("Expected 1 url with an average title length of 2, but got '%v'", stats)
+	}
+
+	if m.Version() != version+1 {
+		t.Errorf("Expected '%v', but got '%v'", version+1, m.Version())
+	}
+
+	// Removing a url that is not in the index does nothing
+	if m.Remove("1") {
+		t.Error("Expected url '1' to no longer be in the index")
+	}
+	if m.Version() != version+1 {
+		t.Errorf("Expected '%v', but got '%v'", version+1, m.Version())
+	}
+}
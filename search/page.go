@@ -0,0 +1,95 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Page sizes for search results.
+const (
+	DefaultPageSize = 10 // Results per page when the request does not ask for a number
+	MaxPageSize     = 50 // Largest number of results returned at once, whatever the request asks for
+)
+
+// ErrInvalidCursor is returned for a cursor that was not issued for the query it is used with.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is one page of the results of a search.
+type Page struct {
+	Results    []Result `json:"results"`
+	Total      int      `json:"total"`                // Number of results across all pages
+	Offset     int      `json:"offset"`               // Position of the first result of the page among all results
+	Limit      int      `json:"limit"`                // Maximum number of results on the page
+	NextCursor string   `json:"nextCursor,omitempty"` // Cursor of the next page, empty on the last page
+	DidYouMean string   `json:"didYouMean,omitempty"` // Spelling correction of a query with few results, empty if there is none
+}
+
+// PageLimit is a function that turns the number of results a request asks for into the page size used.
+// A limit of zero or less asks for the default page size, and a limit above MaxPageSize is lowered to it.
+//
+// Parameters:
+// limit int: The number of results requested.
+//
+// Returns:
+// int: The page size.
+func PageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	return min(limit, MaxPageSize)
+}
+
+// paginate returns the page of the results starting at offset, with the cursor of the page after it.
+func paginate(results []Result, query string, offset int, limit int) Page {
+	limit = PageLimit(limit)
+	offset = max(offset, 0)
+	page := Page{Results: []Result{}, Total: len(results), Offset: offset, Limit: limit}
+	if offset < len(results) {
+		page.Results = results[offset:min(offset+limit, len(results))]
+	}
+	if offset+limit < len(results) {
+		page.NextCursor = encodeCursor(query, offset+limit, limit)
+	}
+	return page
+}
+
+// encodeCursor returns an opaque cursor pointing at a page of the results of a query.
+func encodeCursor(query string, offset int, limit int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%s", offset, limit, queryHash(query))))
+}
+
+// DecodeCursor is a function that reads the page a cursor points at.
+// A cursor is only valid for the query it was issued for, so a cursor used with another query is rejected.
+//
+// Parameters:
+// cursor string: The cursor from the NextCursor of a page.
+// query string: The query the cursor is used with.
+//
+// Returns:
+// int: The offset of the page.
+// int: The page size.
+// error: ErrInvalidCursor if the cursor cannot be read or belongs to another query.
+func DecodeCursor(cursor string, query string) (int, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	var offset, limit int
+	var hash string
+	if _, err := fmt.Sscanf(string(data), "%d:%d:%s", &offset, &limit, &hash); err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	if hash != queryHash(query) || offset < 0 || limit <= 0 {
+		return 0, 0, ErrInvalidCursor
+	}
+	return offset, PageLimit(limit), nil
+}
+
+// queryHash returns a short hash of a query that ties a cursor to it.
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:6])
+}
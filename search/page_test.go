@@ -0,0 +1,80 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	results := make([]Result, 25)
+	for i := range results {
+		results[i].Url = fmt.Sprintf("https://example.com/%d", i)
+	}
+
+	// Define test cases
+	testCases := []struct {
+		offset, limit int
+		first, count  int
+		next          bool
+	}{
+		{0, 0, 0, DefaultPageSize, true},
+		{0, 10, 0, 10, true},
+		{20, 10, 20, 5, false},
+		{15, 10, 15, 10, false},
+		{30, 10, 0, 0, false},
+		// The limit is capped at MaxPageSize
+		{0, 1000, 0, 25, false},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		page := paginate(results, "shoes", tc.offset, tc.limit)
+
+		// Compare the result with the expected value
+		if page.Total != len(results) {
+			t.Errorf("Expected '%v', but got '%v'", len(results), page.Total)
+		}
+		if len(page.Results) != tc.count {
+			t.Errorf("For offset %d and limit %d, expected '%v' results, but got '%v'", tc.offset, tc.limit, tc.count, len(page.Results))
+		}
+		if tc.count > 0 && page.Results[0].Url != results[tc.first].Url {
+			t.Errorf("Expected '%v', but got '%v'", results[tc.first].Url, page.Results[0].Url)
+		}
+		if (page.NextCursor != "") != tc.next {
+			t.Errorf("For offset %d and limit %d, expected a next cursor '%v', but got '%v'", tc.offset, tc.limit, tc.next, page.NextCursor)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	next := paginate(make([]Result, 25), "shoes", 0, 10).NextCursor
+
+	// Define test cases
+	testCases := []struct {
+		cursor, query string
+		offset, limit int
+		valid         bool
+	}{
+		{next, "shoes", 10, 10, true},
+		{encodeCursor("shoes", 20, 1000), "shoes", 20, MaxPageSize, true},
+		// A cursor only works with the query it was issued for
+		{next, "boots", 0, 0, false},
+		{encodeCursor("shoes", -10, 10), "shoes", 0, 0, false},
+		{"not a cursor", "shoes", 0, 0, false},
+		{"", "shoes", 0, 0, false},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		offset, limit, err := DecodeCursor(tc.cursor, tc.query)
+
+		// Compare the result with the expected value
+		if (err == nil) != tc.valid {
+			t.Errorf("For cursor '%s', expected valid '%v', but got error '%v'", tc.cursor, tc.valid, err)
+			continue
+		}
+		if offset != tc.offset || limit != tc.limit {
+			t.Errorf("Expected '%v', but got '%v'", []int{tc.offset, tc.limit}, []int{offset, limit})
+		}
+	}
+}
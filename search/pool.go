@@ -0,0 +1,172 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimiter enforces per-host politeness. It caps the number of requests in flight to a host
+// and keeps a minimum gap between the start of two requests to the same host.
+type hostLimiter struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	hosts       map[string]*hostState
+	maxInFlight int
+	minGap      time.Duration
+}
+
+type hostState struct {
+	inFlight int
+	next     time.Time // Earliest time the next request to the host may start
+}
+
+// newHostLimiter is a function that creates a hostLimiter.
+// A maxInFlight below one is treated as one.
+//
+// Parameters:
+// maxInFlight int: The maximum number of concurrent requests to a single host.
+// minGap time.Duration: The minimum time between the start of two requests to a single host.
+//
+// Returns:
+// *hostLimiter: The new limiter.
+func newHostLimiter(maxInFlight int, minGap time.Duration) *hostLimiter {
+	l := &hostLimiter{
+		hosts:       map[string]*hostState{},
+		maxInFlight: max(maxInFlight, 1),
+		minGap:      minGap,
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// crawlLimiter is the limiter shared by crawl runs and sitemap imports, so a host is never sent more requests than
+// the search settings allow, whichever of them the requests come from.
+var crawlLimiter = newHostLimiter(1, 0)
+
+// sharedLimiter is a function that applies the host limits of the search settings to the limiter shared by every crawl and import.
+// Hosts that are idle and past their gap are forgotten, so the limiter does not grow with every host ever crawled.
+//
+// Parameters:
+// settings db.SearchSettings: The settings holding the HostMaxInFlight and HostDelay limits.
+//
+// Returns:
+// *hostLimiter: The shared limiter.
+func sharedLimiter(settings db.SearchSettings) *hostLimiter {
+	l := crawlLimiter
+	l.mu.Lock()
+	l.maxInFlight = max(int(settings.HostMaxInFlight), 1)
+	l.minGap = time.Duration(settings.HostDelay) * time.Millisecond
+	now := time.Now()
+	for host, state := range l.hosts {
+		if state.inFlight == 0 && now.After(state.next) {
+			delete(l.hosts, host)
+		}
+	}
+	l.mu.Unlock()
+	// Waiters may start now if the limit was raised
+	l.cond.Broadcast()
+	return l
+}
+
+// acquire blocks until a request to the host may start. The gap used is the larger of the
+// limiter's minimum gap and the given delay, which lets a site's Crawl-delay slow us down further.
+// Every call to acquire must be followed by a call to release.
+func (l *hostLimiter) acquire(host string, delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	gap := max(l.minGap, delay)
+	state, ok := l.hosts[host]
+	if !ok {
+		state = &hostState{}
+		l.hosts[host] = state
+	}
+	for {
+		if state.inFlight >= l.maxInFlight {
+			l.cond.Wait()
+			continue
+		}
+		if wait := time.Until(state.next); wait > 0 {
+			// Sleep without holding the lock so other hosts are not blocked
+			l.mu.Unlock()
+			time.Sleep(wait)
+			l.mu.Lock()
+			continue
+		}
+		break
+	}
+	state.inFlight++
+	state.next = time.Now().Add(gap)
+}
+
+// release marks a request to the host as finished.
+func (l *hostLimiter) release(host string) {
+	l.mu.Lock()
+	l.hosts[host].inFlight--
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// runPool is a function that runs the handler over every URL using a bounded number of workers.
+// The URLs are interleaved by host first so that consecutive jobs go to different hosts,
+// which stops a slow or rate limited host from occupying every worker.
+// The function returns once every URL has been handled.
+//
+// Parameters:
+// urls []db.CrawledUrl: The URLs to handle.
+// concurrency int: The number of workers. A value below one is treated as one.
+// handle func(db.CrawledUrl): The function to run for each URL.
+//
+// This function does not return any values.
+func runPool(urls []db.CrawledUrl, concurrency int, handle func(db.CrawledUrl)) {
+	jobs := make(chan db.CrawledUrl)
+	var wg sync.WaitGroup
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				handle(job)
+			}
+		}()
+	}
+	for _, job := range interleaveByHost(urls) {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// interleaveByHost reorders URLs round robin across their hosts, keeping the original order within each host.
+func interleaveByHost(urls []db.CrawledUrl) []db.CrawledUrl {
+	var hosts []string
+	byHost := map[string][]db.CrawledUrl{}
+	for _, u := range urls {
+		host := hostOf(u.Url)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], u)
+	}
+	result := make([]db.CrawledUrl, 0, len(urls))
+	for len(result) < len(urls) {
+		for _, host := range hosts {
+			if queue := byHost[host]; len(queue) > 0 {
+				result = append(result, queue[0])
+				byHost[host] = queue[1:]
+			}
+		}
+	}
+	return result
+}
+
+// hostOf returns the lower case host of a URL, or an empty string if it cannot be parsed.
+func hostOf(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
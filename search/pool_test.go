@@ -0,0 +1,86 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterleaveByHost(t *testing.T) {
+	urls := []db.CrawledUrl{
+		{Url: "https://a.com/1"},
+		{Url: "https://a.com/2"},
+		{Url: "https://a.com/3"},
+		{Url: "https://b.com/1"},
+		{Url: "https://c.com/1"},
+		{Url: "https://b.com/2"},
+	}
+
+	expected := []string{"https://a.com/1", "https://b.com/1", "https://c.com/1", "https://a.com/2", "https://b.com/2", "https://a.com/3"}
+
+	// Call the function
+	result := []string{}
+	for _, u := range interleaveByHost(urls) {
+		result = append(result, u.Url)
+	}
+
+	// Compare the result with the expected value
+	if !equalSlices(result, expected) {
+		t.Errorf("Expected '%v', but got '%v'", expected, result)
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	limiter := newHostLimiter(1, 20*time.Millisecond)
+	var mu sync.Mutex
+	var starts []time.Time
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.acquire("example.com", 0)
+			mu.Lock()
+			starts = append(starts, time.Now())
+			mu.Unlock()
+			limiter.release("example.com")
+		}()
+	}
+	wg.Wait()
+
+	// Every request to the same host should start at least the minimum gap after the previous one
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < 15*time.Millisecond {
+			t.Errorf("Expected requests to be about 20ms apart, but got %v", gap)
+		}
+	}
+}
+
+func TestSharedLimiter(t *testing.T) {
+	settings := db.SearchSettings{HostMaxInFlight: 2, HostDelay: 20}
+
+	// The crawl and an import get the same limiter with the limits of the settings
+	crawl := sharedLimiter(settings)
+	sitemapImport := sharedLimiter(settings)
+	if crawl != sitemapImport || crawl.maxInFlight != 2 || crawl.minGap != 20*time.Millisecond {
+		t.Errorf("Expected one limiter allowing 2 requests 20ms apart, but got '%v' and '%v'", crawl, sitemapImport)
+	}
+
+	// A request of the crawl delays the next request of the import to the same host
+	crawl.acquire("example.com", 0)
+	start := time.Now()
+	sitemapImport.acquire("example.com", 0)
+	if waited := time.Since(start); waited < 15*time.Millisecond {
+		t.Errorf("Expected the import to wait about 20ms, but got %v", waited)
+	}
+	crawl.release("example.com")
+	sitemapImport.release("example.com")
+
+	// Idle hosts are forgotten once their gap has passed
+	time.Sleep(25 * time.Millisecond)
+	sharedLimiter(db.SearchSettings{})
+	if len(crawl.hosts) != 0 || crawl.maxInFlight != 1 {
+		t.Errorf("Expected no hosts and 1 request in flight, but got '%v' and '%v'", crawl.hosts, crawl.maxInFlight)
+	}
+}
@@ -0,0 +1,395 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// QueryError describes why a search query could not be parsed and where.
+type QueryError struct {
+	Message  string `json:"message"`
+	Position int    `json:"position"` // Byte offset in the query where the problem was found
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+// maxSlop is the largest number of words a proximity search may allow between its terms.
+const maxSlop = 100
+
+// maxFuzzyEdits is the largest edit distance a fuzzy term may allow.
+const maxFuzzyEdits = 2
+
+// fieldAny marks a term or phrase that may match in any field.
+const fieldAny field = -1
+
+// queryFields maps the field qualifiers a query can use to the fields they search.
+var queryFields = map[string]field{
+	"title":       fieldTitle,
+	"headings":    fieldHeadings,
+	"description": fieldDescription,
+	"url":         fieldUrl,
+	"body":        fieldBody,
+}
+
+// queryNode is a node of a parsed search query.
+type queryNode interface{}
+
+// termNode matches documents containing every token of a word, optionally only in one field.
+// With edits above zero, each token also matches the tokens of the index within that Levenshtein distance of it.
+type termNode struct {
+	field field
+	text  string
+	edits int
+}
+
+// phraseNode matches documents containing the tokens of a quoted phrase in order and next to each other, optionally only in one field.
+// With a slop above zero the tokens may appear in any order, as long as no more than slop other words come between them.
+type phraseNode struct {
+	field field
+	text  string
+	slop  int
+}
+
+// siteNode matches documents on a host or any of its subdomains.
+type siteNode struct {
+	host string
+}
+
+// andNode matches documents matched by every child.
+type andNode struct {
+	children []queryNode
+}
+
+// orNode matches documents matched by any child.
+type orNode struct {
+	children []queryNode
+}
+
+// notNode matches documents not matched by its child.
+type notNode struct {
+	child queryNode
+}
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenPhrase
+	tokenField
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenOpen
+	tokenClose
+	tokenEnd
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	text  string
+	pos   int
+	slop  int // Proximity of a phrase written as "words"~slop
+	edits int // Edit distance of a fuzzy word written as word~edits
+}
+
+// lexQuery splits a search query into tokens.
+// Words end at whitespace, parentheses and quotes. A word of the form name: followed by more text is split into a field qualifier
+// and its value when name is a known field. A quoted phrase may be followed by ~ and a number of words to make it a proximity search.
+// A word ending in ~ and a number of edits is a fuzzy term. A leading - negates what follows, and the words AND and OR are operators.
+func lexQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: tokenClose, text: ")", pos: i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				return nil, &QueryError{Message: "unterminated quoted phrase", Position: i}
+			}
+			phrase := queryToken{kind: tokenPhrase, text: query[i+1 : i+1+end], pos: i}
+			i += end + 2
+			if i < len(query) && query[i] == '~' {
+				start := i + 1
+				for i = start; i < len(query) && query[i] >= '0' && query[i] <= '9'; i++ {
+				}
+				slop, err := strconv.Atoi(query[start:i])
+				if err != nil || slop > maxSlop {
+					return nil, &QueryError{Message: fmt.Sprintf("~ needs a number of words from 0 to %d", maxSlop), Position: start - 1}
+				}
+				phrase.slop = slop
+			}
+			tokens = append(tokens, phrase)
+		case c == '-':
+			tokens = append(tokens, queryToken{kind: tokenNot, text: "-", pos: i})
+			i++
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n\r()\"", rune(query[i])) {
+				i++
+			}
+			word := query[start:i]
+			if name, value, found := strings.Cut(word, ":"); found {
+				name = strings.ToLower(name)
+				if _, ok := queryFields[name]; ok || name == "site" {
+					tokens = append(tokens, queryToken{kind: tokenField, text: name, pos: start})
+					if value != "" {
+						token, err := lexWord(value, start+len(name)+1)
+						if err != nil {
+							return nil, err
+						}
+						tokens = append(tokens, token)
+					}
+					continue
+				}
+			}
+			switch word {
+			case "AND":
+				tokens = append(tokens, queryToken{kind: tokenAnd, text: word, pos: start})
+			case "OR":
+				tokens = append(tokens, queryToken{kind: tokenOr, text: word, pos: start})
+			default:
+				token, err := lexWord(word, start)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	tokens = append(tokens, queryToken{kind: tokenEnd, pos: len(query)})
+	return tokens, nil
+}
+
+// lexWord returns the token of a word starting at pos, reading the number of edits of a fuzzy word written as word~edits.
+// A ~ followed by something other than a number is kept as part of the word.
+func lexWord(word string, pos int) (queryToken, error) {
+	token := queryToken{kind: tokenWord, text: word, pos: pos}
+	i := strings.LastIndexByte(word, '~')
+	if i <= 0 || strings.TrimLeft(word[i+1:], "0123456789") != "" {
+		return token, nil
+	}
+	edits, err := strconv.Atoi(word[i+1:])
+	if err != nil || edits > maxFuzzyEdits {
+		return token, &QueryError{Message: fmt.Sprintf("~ needs a number of edits from 0 to %d", maxFuzzyEdits), Position: pos + i}
+	}
+	token.text = word[:i]
+	token.edits = edits
+	return token, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+// parseQuery is a function that parses a search query into a tree of query nodes.
+// Terms next to each other must all match, OR between terms lets either match, and AND may be written explicitly.
+// AND binds tighter than OR, and parentheses group terms. A leading - excludes what follows, "quoted phrases" must match
+// word for word, and "quoted phrases"~N match their words in any order within N extra words of each other.
+// title:, headings:, description:, url: and body: limit a term or phrase to one field, and site: limits results to a host and its subdomains. Because exclusions and site: only narrow results, every alternative of the query needs a search term.
+//
+// Parameters:
+// query string: The search query.
+//
+// Returns:
+// queryNode: The root of the parsed query.
+// error: A *QueryError describing why the query could not be parsed.
+func parseQuery(query string) (queryNode, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	if p.peek().kind == tokenEnd {
+		return nil, &QueryError{Message: "query is empty", Position: 0}
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		if t.kind == tokenClose {
+			return nil, &QueryError{Message: "unmatched closing parenthesis", Position: t.pos}
+		}
+		return nil, &QueryError{Message: fmt.Sprintf("unexpected %q", t.text), Position: t.pos}
+	}
+	if !anchored(node) {
+		return nil, &QueryError{Message: "every part of the query needs a search term, exclusions and site: only narrow the results", Position: 0}
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []queryNode{first}
+	for p.peek().kind == tokenOr {
+		p.next()
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &orNode{children: children}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []queryNode{first}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.next()
+		case tokenWord, tokenPhrase, tokenField, tokenNot, tokenOpen:
+			// Terms next to each other are joined with an implicit AND
+		default:
+			if len(children) == 1 {
+				return first, nil
+			}
+			return &andNode{children: children}, nil
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenWord:
+		return &termNode{field: fieldAny, text: t.text, edits: t.edits}, nil
+	case tokenPhrase:
+		if strings.TrimSpace(t.text) == "" {
+			return nil, &QueryError{Message: "quoted phrase is empty", Position: t.pos}
+		}
+		return &phraseNode{field: fieldAny, text: t.text, slop: t.slop}, nil
+	case tokenOpen:
+		if p.peek().kind == tokenClose {
+			return nil, &QueryError{Message: "parentheses are empty", Position: t.pos}
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenClose {
+			return nil, &QueryError{Message: "missing closing parenthesis", Position: t.pos}
+		}
+		p.next()
+		return node, nil
+	case tokenField:
+		value := p.next()
+		if value.kind != tokenWord && value.kind != tokenPhrase {
+			return nil, &QueryError{Message: fmt.Sprintf("%s: needs a value", t.text), Position: t.pos}
+		}
+		if t.text == "site" {
+			if value.edits > 0 {
+				return nil, &QueryError{Message: "site: cannot be fuzzy", Position: value.pos}
+			}
+			host := normalizeSite(value.text)
+			if host == "" {
+				return nil, &QueryError{Message: "site: needs a host", Position: t.pos}
+			}
+			return &siteNode{host: host}, nil
+		}
+		if value.kind == tokenPhrase {
+			return &phraseNode{field: queryFields[t.text], text: value.text, slop: value.slop}, nil
+		}
+		return &termNode{field: queryFields[t.text], text: value.text, edits: value.edits}, nil
+	case tokenEnd:
+		return nil, &QueryError{Message: "query ends unexpectedly", Position: t.pos}
+	case tokenClose:
+		return nil, &QueryError{Message: "unmatched closing parenthesis", Position: t.pos}
+	case tokenNot:
+		return nil, &QueryError{Message: "- needs a term to exclude", Position: t.pos}
+	default:
+		return nil, &QueryError{Message: fmt.Sprintf("unexpected %q", t.text), Position: t.pos}
+	}
+}
+
+// normalizeSite turns the value of a site: qualifier into a lower case host without scheme, path or trailing dot.
+func normalizeSite(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if _, rest, found := strings.Cut(value, "://"); found {
+		value = rest
+	}
+	if i := strings.IndexAny(value, "/?#"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimFunc(value, func(r rune) bool {
+		return r == '.' || unicode.IsSpace(r)
+	})
+}
+
+// anchored reports whether every document a query node matches must contain one of its search terms.
+// Exclusions and site: only narrow down the documents found by search terms, so a query that is not anchored cannot be answered from the index.
+func anchored(node queryNode) bool {
+	switch n := node.(type) {
+	case *termNode, *phraseNode:
+		return true
+	case *andNode:
+		for _, child := range n.children {
+			if anchored(child) {
+				return true
+			}
+		}
+		return false
+	case *orNode:
+		for _, child := range n.children {
+			if !anchored(child) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,208 @@
+package search
+
+import (
+	"errors"
+	"fiber-search-engine/db"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// formatNode renders a parsed query so it can be compared in tests.
+func formatNode(node queryNode) string {
+	fieldName := func(f field) string {
+		for name, qf := range queryFields {
+			if qf == f {
+				return name + ":"
+			}
+		}
+		return ""
+	}
+	join := func(children []queryNode) string {
+		parts := make([]string, len(children))
+		for i, child := range children {
+			parts[i] = formatNode(child)
+		}
+		return strings.Join(parts, " ")
+	}
+	switch n := node.(type) {
+	case *termNode:
+		if n.edits > 0 {
+			return fieldName(n.field) + fmt.Sprintf("%s~%d", n.text, n.edits)
+		}
+		return fieldName(n.field) + n.text
+	case *phraseNode:
+		if n.slop > 0 {
+			return fieldName(n.field) + fmt.Sprintf("%q~%d", n.text, n.slop)
+		}
+		return fieldName(n.field) + fmt.Sprintf("%q", n.text)
+	case *siteNode:
+		return "site:" + n.host
+	case *andNode:
+		return "AND(" + join(n.children) + ")"
+	case *orNode:
+		return "OR(" + join(n.children) + ")"
+	case *notNode:
+		return "NOT(" + formatNode(n.child) + ")"
+	}
+	return "?"
+}
+
+func TestParseQuery(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		{"golang", "golang"},
+		{"golang fiber", "AND(golang fiber)"},
+		{"golang AND fiber", "AND(golang fiber)"},
+		{"golang OR rust", "OR(golang rust)"},
+		{"a b OR c", "OR(AND(a b) c)"},
+		{"a (b OR c)", "AND(a OR(b c))"},
+		{"go -java", "AND(go NOT(java))"},
+		{`"search engine" -"web crawler"`, `AND("search engine" NOT("web crawler"))`},
+		{`title:golang url:"go dev"`, `AND(title:golang url:"go dev")`},
+		{"Title:go headings:intro description:guide", "AND(title:go headings:intro description:guide)"},
+		{"go site:https://Go.dev/doc", "AND(go site:go.dev)"},
+		{"e-mail http://example.com", "AND(e-mail http://example.com)"},
+		{"go -(java OR python)", "AND(go NOT(OR(java python)))"},
+		{`"search engine"~3 go`, `AND("search engine"~3 go)`},
+		{`title:"go fiber"~1`, `title:"go fiber"~1`},
+		{`"go fiber"~0`, `"go fiber"`},
+		{"golnag~1 fiber", "AND(golnag~1 fiber)"},
+		{"title:golnag~2", "title:golnag~2"},
+		{"golang~0", "golang"},
+		{"a~b", "a~b"},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		node, err := parseQuery(tc.query)
+		if err != nil {
+			t.Errorf("For query '%s', unexpected error: %v", tc.query, err)
+			continue
+		}
+		result := formatNode(node)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For query '%s', expected '%s', but got '%s'", tc.query, tc.expected, result)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		query    string
+		position int
+	}{
+		{"", 0},
+		{"   ", 0},
+		{`go "unterminated`, 3},
+		{"(go OR rust", 0},
+		{"go)", 2},
+		{"go ()", 3},
+		{"go OR", 5},
+		{"OR go", 0},
+		{"go -", 4},
+		{"title:", 0},
+		{"go title: (x)", 3},
+		{`go ""`, 3},
+		{"-go", 0},
+		{"site:go.dev", 0},
+		{"go OR -rust", 0},
+		{`"go fiber"~`, 10},
+		{`"go fiber"~x`, 10},
+		{`"go fiber"~1000`, 10},
+		{"go golang~", 9},
+		{"go golang~3", 9},
+		{"title:golang~10", 12},
+		{"go site:go.dev~1", 8},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		_, err := parseQuery(tc.query)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("For query '%s', expected a QueryError, but got '%v'", tc.query, err)
+			continue
+		}
+
+		// Compare the error position with the expected value
+		if queryErr.Position != tc.position {
+			t.Errorf("For query '%s', expected error at position '%d', but got '%d' (%s)", tc.query, tc.position, queryErr.Position, queryErr.Message)
+		}
+	}
+}
+
+func TestEvaluateQuery(t *testing.T) {
+	docs := []db.CrawledUrl{
+		{ID: "1", Url: "https://go.dev/doc", Host: "go.dev", PageTitle: "Go documentation", PageDescription: "Learn the Go programming language"},
+		{ID: "2", Url: "https://blog.go.dev/fiber", Host: "blog.go.dev", PageTitle: "Fiber web framework", PageDescription: "A Go web framework"},
+		{ID: "3", Url: "https://rust-lang.org", Host: "rust-lang.org", PageTitle: "Rust programming language", Headings: "Fast and safe"},
+		{ID: "4", Url: "https://example.com/language", Host: "example.com", PageTitle: "Language learning", PageDescription: "Programming for kids"},
+		{ID: "5", Url: "https://books.example.com", Host: "books.example.com", PageTitle: "The war of the worlds", PageDescription: "Worlds at war, a story of language and fast programming"},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	ctx := &queryContext{postings: map[string]map[string]db.Posting{}, docs: map[string]db.CrawledUrl{}}
+	for token, postings := range idx.Postings {
+		ctx.postings[token] = map[string]db.Posting{}
+		for _, posting := range postings {
+			ctx.postings[token][posting.CrawledUrlID] = posting
+		}
+	}
+	for _, doc := range docs {
+		ctx.docs[doc.ID] = doc
+	}
+
+	// Define test cases
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{"go", []string{"1", "2"}},
+		{"programming language", []string{"1", "3", "4", "5"}},
+		{`"programming language"`, []string{"1", "3"}},
+		{`"language programming"`, []string{}},
+		{"title:programming", []string{"3"}},
+		{"language -rust", []string{"1", "4", "5"}},
+		{"rust OR fiber", []string{"2", "3"}},
+		{"go site:go.dev", []string{"1", "2"}},
+		{"go site:blog.go.dev", []string{"2"}},
+		{"(rust OR fiber) -title:web", []string{"3"}},
+		{"the go", []string{"1", "2"}},
+		{`"war of the worlds"`, []string{"5"}},
+		{`"war of worlds"`, []string{}},
+		{`"war worlds"`, []string{}},
+		{`"worlds war"~1`, []string{"5"}},
+		{`"language programming"~1`, []string{"1", "3"}},
+		{`"language programming"~2`, []string{"1", "3", "5"}},
+		{`description:"language programming"~2`, []string{"1", "5"}},
+		{`"fast safe"~0`, []string{}},
+		{`"fast safe"~1`, []string{"3"}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		node, err := parseQuery(tc.query)
+		if err != nil {
+			t.Errorf("For query '%s', unexpected error: %v", tc.query, err)
+			continue
+		}
+		result := []string{}
+		for id := range ctx.evaluate(node) {
+			result = append(result, id)
+		}
+		sort.Strings(result)
+
+		// Compare the result with the expected value
+		if !equalSlices(result, tc.expected) {
+			t.Errorf("For query '%s', expected '%v', but got '%v'", tc.query, tc.expected, result)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"math"
+	"sort"
+)
+
+// BM25F tuning parameters. k1 controls how quickly repeated terms stop adding to the score
+// and b controls how strongly scores are normalised by document length.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// proximityWeight scales the bonus a document gets when the search terms appear close together.
+const proximityWeight = 0.5
+
+// Result is a crawled url matching a search, together with its relevance score and a snippet showing why it matched.
+// Only the fields meant for the people searching are sent in responses.
+type Result struct {
+	Url         string        `json:"url"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Snippet     string        `json:"snippet"` // HTML escaped, with the matched terms wrapped in the highlight markers
+	Score       float64       `json:"score"`
+	Similar     int           `json:"similar"` // Number of near-duplicate pages collapsed into this result
+	doc         db.CrawledUrl // The indexed url, kept for building the snippet
+}
+
+// newResult returns an unscored result for an indexed url.
+func newResult(doc db.CrawledUrl) *Result {
+	return &Result{Url: doc.Url, Title: doc.PageTitle, Description: doc.PageDescription, doc: doc}
+}
+
+// bm25f returns the BM25F score contribution of a single term for a single document.
+// The term frequency of each field is normalised by the field's length and weighted by the field's boost,
+// and the combined frequency is saturated and multiplied by the term's inverse document frequency as in BM25.
+//
+// Parameters:
+// tf [numFields]int: How many times the term appears in each field of the document.
+// lengths [numFields]int: The number of tokens in each field of the document.
+// avgLengths [numFields]float64: The average number of tokens in each field across the collection.
+// boosts [numFields]float64: The weight of each field.
+// df int: The number of documents the term appears in.
+// n int64: The number of documents in the collection.
+//
+// Returns:
+// float64: The score contribution.
+func bm25f(tf [numFields]int, lengths [numFields]int, avgLengths [numFields]float64, boosts [numFields]float64, df int, n int64) float64 {
+	if df == 0 {
+		return 0
+	}
+	weighted := 0.0
+	for f := range tf {
+		if tf[f] == 0 {
+			continue
+		}
+		norm := 1.0
+		if avgLengths[f] > 0 {
+			norm = 1 - bm25B + bm25B*float64(lengths[f])/avgLengths[f]
+		}
+		weighted += boosts[f] * float64(tf[f]) / norm
+	}
+	if weighted == 0 {
+		return 0
+	}
+	// The +1 keeps the idf positive for terms that appear in more than half of the documents
+	idf := math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+	return idf * weighted * (bm25K1 + 1) / (weighted + bm25K1)
+}
+
+// proximityScore returns the bonus for a document whose search terms appear close together in one of its fields.
+// For every field holding at least two of the terms, it finds the smallest window of words containing each of those terms.
+// The bonus for the field grows with the number of terms in the window and shrinks with the number of other words inside it,
+// so adjacent terms earn the most. It is weighted by the field's boost and the best field counts.
+//
+// Parameters:
+// positions [numFields][]db.Positions: For every field, the positions of each distinct search term found in that field.
+// boosts [numFields]float64: The weight of each field.
+//
+// Returns:
+// float64: The proximity bonus, zero when no field holds two of the terms.
+func proximityScore(positions [numFields][]db.Positions, boosts [numFields]float64) float64 {
+	best := 0.0
+	for f, lists := range positions {
+		if len(lists) < 2 {
+			continue
+		}
+		terms := len(lists)
+		gap := minWindow(lists) - (terms - 1)
+		score := proximityWeight * boosts[f] * float64(terms-1) / float64(1+gap)
+		best = max(best, score)
+	}
+	return best
+}
+
+// minWindow returns the span, last position minus first, of the smallest window holding a position from every list.
+// Every list must be sorted and not empty.
+func minWindow(lists []db.Positions) int {
+	next := make([]int, len(lists))
+	best := math.MaxInt
+	for {
+		lowest, highest := 0, lists[0][next[0]]
+		for i := range lists {
+			position := lists[i][next[i]]
+			if position < lists[lowest][next[lowest]] {
+				lowest = i
+			}
+			highest = max(highest, position)
+		}
+		best = min(best, highest-lists[lowest][next[lowest]])
+		// Moving past the lowest position is the only way to find a smaller window
+		next[lowest]++
+		if next[lowest] == len(lists[lowest]) {
+			return best
+		}
+	}
+}
+
+// sortResults returns the results sorted by descending score, breaking ties by url so the order is stable.
+func sortResults(results map[string]*Result) []Result {
+	sorted := make([]Result, 0, len(results))
+	for _, result := range results {
+		sorted = append(sorted, *result)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Score != sorted[j].Score {
+			return sorted[i].Score > sorted[j].Score
+		}
+		return sorted[i].Url < sorted[j].Url
+	})
+	return sorted
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"testing"
+)
+
+func TestBM25F(t *testing.T) {
+	lengths := [numFields]int{5, 5, 20, 4}
+	avgLengths := [numFields]float64{5, 5, 20, 4}
+	boosts := [numFields]float64{3, 2, 1, 0.5}
+	score := func(tf [numFields]int, df int) float64 {
+		return bm25f(tf, lengths, avgLengths, boosts, df, 1000)
+	}
+
+	// A term that appears more often scores higher
+	if score([numFields]int{0, 0, 3, 0}, 10) <= score([numFields]int{0, 0, 1, 0}, 10) {
+		t.Error("Expected a higher term frequency to score higher")
+	}
+	// Repeating a term has diminishing returns
+	gainLow := score([numFields]int{0, 0, 2, 0}, 10) - score([numFields]int{0, 0, 1, 0}, 10)
+	gainHigh := score([numFields]int{0, 0, 11, 0}, 10) - score([numFields]int{0, 0, 10, 0}, 10)
+	if gainHigh >= gainLow {
+		t.Errorf("Expected the score to saturate, but got gains '%v' and '%v'", gainLow, gainHigh)
+	}
+	// A rarer term scores higher
+	if score([numFields]int{0, 0, 1, 0}, 500) >= score([numFields]int{0, 0, 1, 0}, 5) {
+		t.Error("Expected a rarer term to score higher")
+	}
+	// A match in the title scores higher than a match in the description, which scores higher than a match in the url
+	title := score([numFields]int{1, 0, 0, 0}, 10)
+	description := score([numFields]int{0, 0, 1, 0}, 10)
+	url := score([numFields]int{0, 0, 0, 1}, 10)
+	if title <= description || description <= url {
+		t.Errorf("Expected title > description > url, but got '%v', '%v' and '%v'", title, description, url)
+	}
+	// A match in a longer field scores lower
+	long := bm25f([numFields]int{1, 0, 0, 0}, [numFields]int{20, 5, 20, 4}, avgLengths, boosts, 10, 1000)
+	if long >= title {
+		t.Error("Expected a match in a longer title to score lower")
+	}
+	// A term in every document still scores above zero
+	if score([numFields]int{0, 0, 1, 0}, 1000) <= 0 {
+		t.Error("Expected a term in every document to score above zero")
+	}
+	// A missing term, or a term only found in fields with no boost, scores zero
+	if score([numFields]int{}, 10) != 0 {
+		t.Error("Expected a missing term to score zero")
+	}
+	if bm25f([numFields]int{1, 0, 0, 0}, lengths, avgLengths, [numFields]float64{0, 2, 1, 0.5}, 10, 1000) != 0 {
+		t.Error("Expected a match in a field with no boost to score zero")
+	}
+}
+
+func TestMinWindow(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		lists    []db.Positions
+		expected int
+	}{
+		{[]db.Positions{{0}, {1}}, 1},
+		{[]db.Positions{{5}, {1}}, 4},
+		{[]db.Positions{{0, 10}, {4, 12}}, 2},
+		{[]db.Positions{{1, 20}, {3, 22}, {7, 21}}, 2},
+		{[]db.Positions{{3}}, 0},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := minWindow(tc.lists)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For lists '%v', expected '%d', but got '%d'", tc.lists, tc.expected, result)
+		}
+	}
+}
+
+func TestProximityScore(t *testing.T) {
+	boosts := [numFields]float64{3, 2, 1, 0.5}
+	score := func(f field, lists ...db.Positions) float64 {
+		var positions [numFields][]db.Positions
+		positions[f] = lists
+		return proximityScore(positions, boosts)
+	}
+
+	// Adjacent terms score higher than terms further apart
+	if score(fieldDescription, db.Positions{0}, db.Positions{1}) <= score(fieldDescription, db.Positions{0}, db.Positions{5}) {
+		t.Error("Expected adjacent terms to score higher")
+	}
+	// More terms close together score higher
+	if score(fieldDescription, db.Positions{0}, db.Positions{1}, db.Positions{2}) <= score(fieldDescription, db.Positions{0}, db.Positions{1}) {
+		t.Error("Expected three adjacent terms to score higher than two")
+	}
+	// Close terms in the title score higher than in the description
+	if score(fieldTitle, db.Positions{0}, db.Positions{1}) <= score(fieldDescription, db.Positions{0}, db.Positions{1}) {
+		t.Error("Expected proximity in the title to score higher")
+	}
+	// A single term gets no bonus
+	if score(fieldTitle, db.Positions{0, 1}) != 0 {
+		t.Error("Expected a single term to score zero")
+	}
+}
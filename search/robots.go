@@ -0,0 +1,275 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsAgentToken is the product token matched against User-agent lines in robots.txt.
+	robotsAgentToken = "fibersearchbot"
+	// robotsCacheTTL is how long a fetched robots.txt is trusted before it is fetched again.
+	robotsCacheTTL = 24 * time.Hour
+	// robotsErrorTTL is how long a failed robots.txt fetch is remembered before retrying.
+	robotsErrorTTL = time.Hour
+	// robotsMaxSize is the maximum number of bytes read from a robots.txt file.
+	robotsMaxSize = 512 * 1024
+	// maxCrawlDelay caps the Crawl-delay a site can ask for so one host cannot stall a crawl run.
+	maxCrawlDelay = time.Minute
+)
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsRules holds the parsed contents of a single host's robots.txt file.
+type robotsRules struct {
+	groups    []*robotsGroup
+	sitemaps  []string
+	fetchedAt time.Time
+	ttl       time.Duration
+}
+
+// allowAllRobots is used when a host has no robots.txt file.
+func allowAllRobots() *robotsRules {
+	return &robotsRules{}
+}
+
+// disallowAllRobots is used when a host's robots.txt cannot be fetched because of a server or network error.
+func disallowAllRobots() *robotsRules {
+	return &robotsRules{groups: []*robotsGroup{{
+		agents: []string{"*"},
+		rules:  []robotsRule{{allow: false, pattern: "/"}},
+	}}}
+}
+
+// parseRobots is a function that parses a robots.txt file into a robotsRules struct.
+// Consecutive User-agent lines start a group and every Allow, Disallow and Crawl-delay line that follows belongs to that group.
+// Sitemap lines are not tied to a group and are collected for the whole file.
+// Unknown directives, comments and malformed lines are ignored.
+//
+// Parameters:
+// body io.Reader: The contents of the robots.txt file.
+//
+// Returns:
+// *robotsRules: The parsed rules.
+func parseRobots(body io.Reader) *robotsRules {
+	rules := &robotsRules{}
+	var current *robotsGroup
+	// inAgents is true while we are reading a run of User-agent lines
+	inAgents := false
+
+	scanner := bufio.NewScanner(io.LimitReader(body, robotsMaxSize))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Strip comments
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &robotsGroup{}
+				rules.groups = append(rules.groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			// Rules before any User-agent line and empty patterns have no effect
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			current.crawlDelay = time.Duration(seconds * float64(time.Second))
+		case "sitemap":
+			if value != "" {
+				rules.sitemaps = append(rules.sitemaps, value)
+			}
+		}
+	}
+	return rules
+}
+
+// group returns the group that applies to the given user agent.
+// A group naming the agent's product token wins over the "*" group. If no group applies it returns nil.
+func (r *robotsRules) group(agent string) *robotsGroup {
+	var fallback *robotsGroup
+	for _, g := range r.groups {
+		for _, name := range g.agents {
+			if name == agent || strings.HasPrefix(name, agent+"/") {
+				return g
+			}
+			if name == "*" && fallback == nil {
+				fallback = g
+			}
+		}
+	}
+	return fallback
+}
+
+// allowed is a method on the robotsRules struct that reports whether the crawler may fetch the given URL.
+// The most specific (longest) matching rule decides, and Allow wins when an Allow and a Disallow rule are equally specific.
+// A URL that matches no rule is allowed.
+//
+// Parameters:
+// u *url.URL: The URL to test.
+//
+// Returns:
+// bool: True if the URL may be crawled, false otherwise.
+func (r *robotsRules) allowed(u *url.URL) bool {
+	g := r.group(robotsAgentToken)
+	if g == nil {
+		return true
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	allowed, matchLen := true, -1
+	for _, rule := range g.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > matchLen || (len(rule.pattern) == matchLen && rule.allow) {
+			allowed, matchLen = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// crawlDelay is a method on the robotsRules struct that returns the Crawl-delay that applies to our crawler.
+// The delay is capped at maxCrawlDelay. If the site does not set one it returns zero.
+//
+// Returns:
+// time.Duration: The minimum time to wait between two requests to the host.
+func (r *robotsRules) crawlDelay() time.Duration {
+	g := r.group(robotsAgentToken)
+	if g == nil {
+		return 0
+	}
+	return min(g.crawlDelay, maxCrawlDelay)
+}
+
+// matchRobotsPattern reports whether a robots.txt path pattern matches the path.
+// Patterns match from the start of the path, "*" matches any run of characters and a trailing "$" anchors the end.
+func matchRobotsPattern(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if anchored && i == len(parts)-1 {
+			return strings.HasSuffix(path[pos:], parts[i])
+		}
+		idx := strings.Index(path[pos:], parts[i])
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(parts[i])
+	}
+	return !anchored || pos == len(path)
+}
+
+type robotsCache struct {
+	mu    sync.Mutex
+	hosts map[string]*robotsRules
+}
+
+// robots is the process wide cache of robots.txt rules keyed by scheme and host.
+var robots = &robotsCache{hosts: map[string]*robotsRules{}}
+
+// getRobots is a function that returns the robots.txt rules for the host of the given URL.
+// Rules are cached per scheme and host and fetched again once they expire.
+//
+// Parameters:
+// u *url.URL: Any URL on the host.
+//
+// Returns:
+// *robotsRules: The rules that apply to the host.
+func getRobots(u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + strings.ToLower(u.Host)
+	robots.mu.Lock()
+	rules, ok := robots.hosts[key]
+	robots.mu.Unlock()
+	if ok && time.Since(rules.fetchedAt) < rules.ttl {
+		return rules
+	}
+
+	rules = fetchRobots(key)
+	robots.mu.Lock()
+	robots.hosts[key] = rules
+	robots.mu.Unlock()
+	return rules
+}
+
+// fetchRobots is a function that downloads and parses the robots.txt file of a host.
+// A 4xx response means the host has no rules and everything is allowed.
+// A 5xx response or a network error means the host cannot tell us what is allowed, so everything is disallowed until the next retry.
+// Redirects are only followed within the host, and a redirect to another host counts as a network error.
+//
+// Parameters:
+// origin string: The scheme and host of the site, for example https://example.com.
+//
+// Returns:
+// *robotsRules: The parsed rules.
+func fetchRobots(origin string) *robotsRules {
+	var rules *robotsRules
+	ttl := robotsCacheTTL
+	// The rules of another host cannot be checked before its own robots.txt is read, so redirects stay on the host
+	resp, err := fetch(origin+"/robots.txt", sameHostRedirects(origin))
+	switch {
+	case err != nil:
+		fmt.Printf("something went wrong fetching robots.txt for %v: %v\n", origin, err)
+		rules, ttl = disallowAllRobots(), robotsErrorTTL
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		rules = parseRobots(resp.Body)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		rules = allowAllRobots()
+	default:
+		rules, ttl = disallowAllRobots(), robotsErrorTTL
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	rules.fetchedAt = time.Now()
+	rules.ttl = ttl
+	return rules
+}
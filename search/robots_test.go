@@ -0,0 +1,194 @@
+package search
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	// Create a sample robots.txt
+	body := strings.NewReader(`
+		# Comments and unknown directives are ignored
+		User-agent: *
+		Disallow: /private/
+		Crawl-delay: 10
+
+		User-agent: OtherBot
+		User-agent: FiberSearchBot
+		Disallow: /
+		Allow: /public/
+		Allow: /*.html$
+		Crawl-delay: 2.5
+
+		Sitemap: https://example.com/sitemap.xml
+	`)
+
+	rules := parseRobots(body)
+
+	// Compare the number of groups with the expected value
+	if len(rules.groups) != 2 {
+		t.Fatalf("Expected 2 groups, but got %d", len(rules.groups))
+	}
+
+	// Compare the agents of the second group with the expected value
+	if !equalSlices(rules.groups[1].agents, []string{"otherbot", "fibersearchbot"}) {
+		t.Errorf("Expected agents '%v', but got '%v'", []string{"otherbot", "fibersearchbot"}, rules.groups[1].agents)
+	}
+
+	// Compare the crawl delay with the expected value
+	if rules.crawlDelay() != 2500*time.Millisecond {
+		t.Errorf("Expected crawl delay '%v', but got '%v'", 2500*time.Millisecond, rules.crawlDelay())
+	}
+
+	// Compare the sitemaps with the expected value
+	if !equalSlices(rules.sitemaps, []string{"https://example.com/sitemap.xml"}) {
+		t.Errorf("Expected sitemaps '%v', but got '%v'", []string{"https://example.com/sitemap.xml"}, rules.sitemaps)
+	}
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	rules := parseRobots(strings.NewReader(`
+		User-agent: *
+		Disallow: /
+
+		User-agent: fibersearchbot
+		Disallow: /private
+		Allow: /private/open
+		Disallow: /*.pdf$
+		Disallow: /search?
+		Allow: /page
+		Disallow: /page
+	`))
+
+	// Define test cases
+	testCases := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://example.com/", true},
+		{"https://example.com", true},
+		{"https://example.com/private", false},
+		{"https://example.com/private/secret", false},
+		{"https://example.com/private/open/page", true},
+		{"https://example.com/files/report.pdf", false},
+		{"https://example.com/files/report.pdf?download=1", true},
+		{"https://example.com/search?q=go", false},
+		{"https://example.com/search", true},
+		{"https://example.com/page", true},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		u, _ := url.Parse(tc.url)
+		result := rules.allowed(u)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For url '%s', expected '%v', but got '%v'", tc.url, tc.expected, result)
+		}
+	}
+}
+
+func TestRobotsDefaultGroup(t *testing.T) {
+	rules := parseRobots(strings.NewReader(`
+		User-agent: googlebot
+		Disallow: /
+
+		User-agent: *
+		Disallow: /admin
+	`))
+
+	u, _ := url.Parse("https://example.com/admin/users")
+	if rules.allowed(u) {
+		t.Errorf("Expected '%s' to be disallowed by the * group", u)
+	}
+	u, _ = url.Parse("https://example.com/blog")
+	if !rules.allowed(u) {
+		t.Errorf("Expected '%s' to be allowed by the * group", u)
+	}
+	// Hosts without robots.txt allow everything
+	if !allowAllRobots().allowed(u) {
+		t.Errorf("Expected '%s' to be allowed when there is no robots.txt", u)
+	}
+	// Hosts whose robots.txt cannot be fetched allow nothing
+	if disallowAllRobots().allowed(u) {
+		t.Errorf("Expected '%s' to be disallowed when robots.txt is unavailable", u)
+	}
+}
+
+func TestMatchRobotsPattern(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.html", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/fish$", "/fish", true},
+		{"/fish$", "/fish/", false},
+		{"/*/end$", "/a/b/end", true},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := matchRobotsPattern(tc.pattern, tc.path)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For pattern '%s' and path '%s', expected '%v', but got '%v'", tc.pattern, tc.path, tc.expected, result)
+		}
+	}
+}
+
+func TestFetchRobotsRedirect(t *testing.T) {
+	// Create a server whose robots.txt redirects within its host
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.Redirect(w, r, "/rules.txt", http.StatusMovedPermanently)
+		case "/rules.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// Create a server whose robots.txt redirects to the first server, which is another host
+	moved := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+"/rules.txt", http.StatusMovedPermanently)
+	}))
+	defer moved.Close()
+
+	// Define test cases
+	testCases := []struct {
+		origin   string
+		path     string
+		expected bool
+	}{
+		{server.URL, "/public", true},
+		{server.URL, "/private/page", false},
+		{moved.URL, "/public", false},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		rules := fetchRobots(tc.origin)
+		u, _ := url.Parse(tc.origin + tc.path)
+		result := rules.allowed(u)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For '%s', expected '%v', but got '%v'", u, tc.expected, result)
+		}
+	}
+}
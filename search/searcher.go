@@ -0,0 +1,379 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// settingsVersion counts the changes made to the search settings, so cached search results can be told apart.
+var settingsVersion atomic.Uint64
+
+// SettingsChanged is a function that records a change to the search settings.
+// It should be called whenever the settings searches are ranked and highlighted with are updated, so cached results are no longer served.
+//
+// This function does not take any parameters and does not return any values.
+func SettingsChanged() {
+	settingsVersion.Add(1)
+}
+
+// SettingsVersion is a function that returns the number of changes made to the search settings since the server started.
+//
+// This function does not take any parameters.
+//
+// Returns:
+// uint64: The version of the search settings.
+func SettingsVersion() uint64 {
+	return settingsVersion.Load()
+}
+
+// docSet is a set of url IDs.
+type docSet map[string]struct{}
+
+// queryContext holds everything needed to evaluate a parsed query: the postings of every token it mentions
+// and the candidate urls, which are all urls containing one of the query's search terms.
+type queryContext struct {
+	postings map[string]map[string]db.Posting // Token to url ID to posting
+	docs     map[string]db.CrawledUrl         // Candidate urls by ID
+}
+
+// scoredTerm is a token that adds to the score of the urls it matches, limited to one field unless the field is fieldAny.
+// Its score is multiplied by its weight, which is below one for the tokens matched by a fuzzy term.
+type scoredTerm struct {
+	token  string
+	field  field
+	weight float64
+}
+
+// FullTextSearch is a function that performs a full-text search on the search index and ranks the results with BM25F.
+// The query is parsed with parseQuery, so it may combine terms with AND and OR, group them with parentheses, exclude them with -,
+// match "quoted phrases" exactly or within N words with "quoted phrases"~N, and limit terms to a field with title:, headings:, description:, url:, body: or to a host with site:.
+// Every term and phrase is run through the same analyzer as the indexed text, and the resulting tokens are looked up exactly
+// in the in-memory index loaded by LoadIndex, so answering a query does not touch the database apart from reading the search settings.
+// The urls containing any of the search terms are the candidates the query is evaluated against.
+// Each matching url is scored by adding the BM25F score of every search term it contains, where a match counts more or less
+// depending on the field it is in, using the field boosts from the search settings. Excluded terms do not add to the score.
+// Urls where several search terms appear close together in a field get an extra proximity bonus, the largest when they are adjacent.
+// The matching urls are sorted by descending score, and pages whose body text is a near-duplicate of a better ranked match are collapsed
+// into it and counted in its Similar count, so mirrors and syndicated copies take up one result.
+// The page of limit results starting at offset is then returned,
+// with the total number of matches and a cursor for the next page. The limit is capped at MaxPageSize.
+// Each result on the page has a snippet of the text around the matched terms, wrapped in the highlight markers from the search settings.
+// When the query finds few results, a spelling correction that finds more is suggested in the DidYouMean of the page.
+//
+// Parameters:
+// value string: The search query string.
+// offset int: The number of best matches to skip.
+// limit int: The number of results on the page, or zero for DefaultPageSize.
+//
+// Returns:
+// Page: The page of results, best match first, with the total number of matches.
+// error: A *QueryError if the query could not be parsed, or an error object that describes an error that occurred during the function's execution.
+func FullTextSearch(value string, offset int, limit int) (Page, error) {
+	root, err := parseQuery(value)
+	if err != nil {
+		return Page{}, err
+	}
+	root = memIndex.expandFuzzy(root)
+	boosts := defaultBoosts
+	markers := defaultMarkers
+	settings := &db.SearchSettings{}
+	if err := settings.Get(); err == nil {
+		boosts = settingsBoosts(*settings)
+		markers = settingsMarkers(*settings)
+	}
+	page := paginate(memIndex.search(root, boosts), value, offset, limit)
+	addSnippets(page.Results, root, markers)
+	page.DidYouMean = didYouMean(value, page.Total, boosts)
+	return page, nil
+}
+
+// addSnippets fills in the snippet of every result, highlighting the search terms of the query that are not excluded.
+func addSnippets(results []Result, root queryNode, markers Markers) {
+	var terms []scoredTerm
+	var tokens []string
+	collectTerms(root, false, &terms, &tokens)
+	highlight := map[string]bool{}
+	for _, term := range terms {
+		highlight[term.token] = true
+	}
+	for i := range results {
+		results[i].Snippet = makeSnippet(results[i].doc, highlight, markers)
+	}
+}
+
+// search evaluates a parsed query against the index and scores the matching urls with the given field boosts.
+// Near-duplicate pages are collapsed into the best ranked page of their cluster by collapseDuplicates.
+// It holds a read lock while it runs, so an update waits for it and it never sees a half applied update.
+func (m *MemIndex) search(root queryNode, boosts [numFields]float64) []Result {
+	var terms []scoredTerm
+	var tokens []string
+	collectTerms(root, false, &terms, &tokens)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ctx := &queryContext{postings: map[string]map[string]db.Posting{}, docs: map[string]db.CrawledUrl{}}
+	for _, token := range uniqueTokens(tokens) {
+		if byDoc, ok := m.postings[token]; ok {
+			ctx.postings[token] = byDoc
+		}
+	}
+	// Candidates are the urls containing a search term that is not excluded
+	for _, term := range terms {
+		for id := range ctx.postings[term.token] {
+			ctx.docs[id] = m.docs[id]
+		}
+	}
+	if len(ctx.docs) == 0 {
+		return []Result{}
+	}
+
+	stats := m.stats()
+	avgLengths := avgFieldLengths(stats)
+	results := map[string]*Result{}
+	for id := range ctx.evaluate(root) {
+		doc := ctx.docs[id]
+		result := newResult(doc)
+		for _, term := range terms {
+			posting, ok := ctx.postings[term.token][id]
+			if !ok {
+				continue
+			}
+			tf := fieldFrequencies(posting)
+			if term.field != fieldAny {
+				tf = onlyField(tf, term.field)
+			}
+			result.Score += term.weight * bm25f(tf, fieldLengths(doc), avgLengths, boosts, len(ctx.postings[term.token]), stats.Count)
+		}
+		result.Score += proximityScore(ctx.termPositions(id, terms), boosts)
+		results[id] = result
+	}
+	return collapseDuplicates(sortResults(results))
+}
+
+// termPositions returns, for every field of a url, the positions of each distinct scored token found in that field.
+func (ctx *queryContext) termPositions(id string, terms []scoredTerm) [numFields][]db.Positions {
+	var result [numFields][]db.Positions
+	seen := map[string]bool{}
+	for _, term := range terms {
+		if seen[term.token] {
+			continue
+		}
+		seen[term.token] = true
+		posting, ok := ctx.postings[term.token][id]
+		if !ok {
+			continue
+		}
+		for f, positions := range fieldPositions(posting) {
+			if len(positions) > 0 {
+				result[f] = append(result[f], positions)
+			}
+		}
+	}
+	return result
+}
+
+// collectTerms walks a parsed query and collects the tokens of its terms and phrases.
+// Every token is added to tokens so its postings are loaded, and tokens that are not excluded are also added to terms so they are scored.
+func collectTerms(node queryNode, negated bool, terms *[]scoredTerm, tokens *[]string) {
+	switch n := node.(type) {
+	case *termNode:
+		collectTokens(analyze(n.text), n.field, negated, terms, tokens)
+	case *phraseNode:
+		collectTokens(analyze(n.text), n.field, negated, terms, tokens)
+	case *fuzzyNode:
+		for _, alternatives := range n.alternatives {
+			for _, alternative := range alternatives {
+				*tokens = append(*tokens, alternative.token)
+				if !negated {
+					addTerm(terms, scoredTerm{token: alternative.token, field: n.field, weight: alternative.weight})
+				}
+			}
+		}
+	case *andNode:
+		for _, child := range n.children {
+			collectTerms(child, negated, terms, tokens)
+		}
+	case *orNode:
+		for _, child := range n.children {
+			collectTerms(child, negated, terms, tokens)
+		}
+	case *notNode:
+		collectTerms(n.child, !negated, terms, tokens)
+	}
+}
+
+func collectTokens(analyzed []string, f field, negated bool, terms *[]scoredTerm, tokens *[]string) {
+	for _, token := range analyzed {
+		*tokens = append(*tokens, token)
+		if !negated {
+			addTerm(terms, scoredTerm{token: token, field: f, weight: 1})
+		}
+	}
+}
+
+// addTerm adds a scored term, keeping only the highest weight when the same token is searched for in the same field more than once.
+func addTerm(terms *[]scoredTerm, term scoredTerm) {
+	for i, existing := range *terms {
+		if existing.token == term.token && existing.field == term.field {
+			(*terms)[i].weight = max(existing.weight, term.weight)
+			return
+		}
+	}
+	*terms = append(*terms, term)
+}
+
+// evaluate returns the candidate urls matched by a query node.
+func (ctx *queryContext) evaluate(node queryNode) docSet {
+	switch n := node.(type) {
+	case *termNode:
+		return ctx.matchTokens(analyze(n.text), n.field)
+	case *fuzzyNode:
+		return ctx.matchFuzzy(n)
+	case *phraseNode:
+		tokens, offsets := analyzePositions(n.text)
+		result := docSet{}
+		for id := range ctx.matchTokens(tokens, n.field) {
+			if ctx.matchesPhrase(id, tokens, offsets, n.field, n.slop) {
+				result[id] = struct{}{}
+			}
+		}
+		return result
+	case *siteNode:
+		result := docSet{}
+		for id, doc := range ctx.docs {
+			if onSite(doc.Host, n.host) {
+				result[id] = struct{}{}
+			}
+		}
+		return result
+	case *andNode:
+		result := ctx.evaluate(n.children[0])
+		for _, child := range n.children[1:] {
+			other := ctx.evaluate(child)
+			for id := range result {
+				if _, ok := other[id]; !ok {
+					delete(result, id)
+				}
+			}
+		}
+		return result
+	case *orNode:
+		result := docSet{}
+		for _, child := range n.children {
+			for id := range ctx.evaluate(child) {
+				result[id] = struct{}{}
+			}
+		}
+		return result
+	case *notNode:
+		excluded := ctx.evaluate(n.child)
+		result := docSet{}
+		for id := range ctx.docs {
+			if _, ok := excluded[id]; !ok {
+				result[id] = struct{}{}
+			}
+		}
+		return result
+	}
+	return docSet{}
+}
+
+// matchTokens returns the candidate urls containing every token, in the given field unless it is fieldAny.
+// A term made only of stopwords has no tokens and matches every candidate, so it does not narrow the query.
+func (ctx *queryContext) matchTokens(tokens []string, f field) docSet {
+	result := docSet{}
+	for id := range ctx.docs {
+		result[id] = struct{}{}
+	}
+	for _, token := range tokens {
+		postings := ctx.postings[token]
+		for id := range result {
+			posting, ok := postings[id]
+			if !ok || (f != fieldAny && fieldFrequencies(posting)[f] == 0) {
+				delete(result, id)
+			}
+		}
+	}
+	return result
+}
+
+// matchesPhrase reports whether the tokens of a phrase appear in a field of the url, in the given field unless it is fieldAny.
+// With a slop of zero, every token must be found at the same distance from the first token as in the phrase, so the words are
+// in order and only stopwords may come between them where the phrase has them too. With a higher slop, the tokens may be in any order
+// as long as the smallest window holding all of them spans at most slop words more than the phrase itself.
+func (ctx *queryContext) matchesPhrase(id string, tokens []string, offsets []int, f field, slop int) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	for g := field(0); g < numFields; g++ {
+		if f != fieldAny && g != f {
+			continue
+		}
+		lists := make([]db.Positions, len(tokens))
+		found := true
+		for i, token := range tokens {
+			lists[i] = fieldPositions(ctx.postings[token][id])[g]
+			if len(lists[i]) == 0 {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		if slop == 0 && containsAtOffsets(lists, offsets) {
+			return true
+		}
+		if slop > 0 && minWindow(uniquePositionLists(tokens, lists)) <= offsets[len(offsets)-1]-offsets[0]+slop {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAtOffsets reports whether there is a start position such that every list holds the start plus its offset from the first offset.
+func containsAtOffsets(lists []db.Positions, offsets []int) bool {
+	for _, start := range lists[0] {
+		match := true
+		for i := 1; i < len(lists); i++ {
+			want := start + offsets[i] - offsets[0]
+			j := sort.SearchInts(lists[i], want)
+			if j == len(lists[i]) || lists[i][j] != want {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// uniquePositionLists returns the position lists of the distinct tokens, so a repeated word is not required to appear twice in a window.
+func uniquePositionLists(tokens []string, lists []db.Positions) []db.Positions {
+	seen := map[string]bool{}
+	var r []db.Positions
+	for i, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			r = append(r, lists[i])
+		}
+	}
+	return r
+}
+
+// onSite reports whether a host is the site's host or one of its subdomains.
+func onSite(host string, site string) bool {
+	host, _, _ = strings.Cut(strings.ToLower(host), ":")
+	return host == site || strings.HasSuffix(host, "."+site)
+}
+
+// onlyField returns the term frequencies with every field but one set to zero.
+func onlyField(tf [numFields]int, f field) [numFields]int {
+	var result [numFields]int
+	result[f] = tf[f]
+	return result
+}
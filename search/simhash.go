@@ -0,0 +1,119 @@
+package search
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+// shingleSize is the number of consecutive words in a shingle, the unit of text compared by simHash.
+const shingleSize = 3
+
+// minSimHashShingles is the number of shingles a text needs to be fingerprinted. Shorter texts, such as a "Please enable JavaScript"
+// shell or a cookie notice, are shared by unrelated pages and would make them look like near-duplicates.
+const minSimHashShingles = 16
+
+// nearDuplicateDistance is the largest number of differing bits between the fingerprints of two near-duplicate pages.
+// Keeping it below simHashBlocks means two near-duplicates always share one block of their fingerprints exactly.
+const nearDuplicateDistance = 3
+
+// simHashBlocks is the number of blocks a fingerprint is split into to find the fingerprints close to it.
+const simHashBlocks = 4
+
+// simHash is a function that computes a fingerprint of a text that changes little when the text changes little.
+// The text is split into lower case words and every run of shingleSize consecutive words is hashed with 64-bit FNV-1a.
+// Each bit of the fingerprint is set when more shingle hashes have that bit set than not, so texts sharing most of their shingles
+// get fingerprints that differ in only a few bits, unlike a regular hash where any change flips half of them.
+// A text with fewer than minSimHashShingles shingles is too short to tell pages apart and gets no fingerprint.
+//
+// Parameters:
+// text string: The text to fingerprint.
+//
+// Returns:
+// uint64: The fingerprint, or zero for a text that is too short.
+func simHash(text string) uint64 {
+	words := lowercaseFilter(tokenize(text))
+	if len(words)-shingleSize+1 < minSimHashShingles {
+		return 0
+	}
+	var weights [64]int
+	for start := 0; start+shingleSize <= len(words); start++ {
+		h := fnv.New64a()
+		for _, word := range words[start : start+shingleSize] {
+			h.Write([]byte(word))
+			h.Write([]byte{' '})
+		}
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// isNearDuplicate reports whether two fingerprints are at most nearDuplicateDistance bits apart.
+// A zero fingerprint belongs to a page with too little text or crawled before fingerprints were stored, and matches nothing.
+func isNearDuplicate(a uint64, b uint64) bool {
+	return a != 0 && b != 0 && bits.OnesCount64(a^b) <= nearDuplicateDistance
+}
+
+// simHashBlock returns one of the simHashBlocks blocks of bits of a fingerprint.
+func simHashBlock(fingerprint uint64, block int) uint64 {
+	size := 64 / simHashBlocks
+	return (fingerprint >> (block * size)) & (1<<size - 1)
+}
+
+// collapseDuplicates is a function that clusters the near-duplicate pages of ranked search results and keeps one result per cluster.
+// The results are visited best match first, and every result whose fingerprint is near the fingerprint of a result kept before it
+// is dropped and counted in the Similar count of that result, so each cluster is shown as its best ranked page.
+// Kept fingerprints are bucketed by each of their blocks: two fingerprints differing in fewer bits than there are blocks
+// share at least one block, so only the results in the same buckets are compared.
+//
+// Parameters:
+// results []Result: The results, best match first.
+//
+// Returns:
+// []Result: The results without their near-duplicates, best match first.
+func collapseDuplicates(results []Result) []Result {
+	collapsed := make([]Result, 0, len(results))
+	var buckets [simHashBlocks]map[uint64][]int
+	for block := range buckets {
+		buckets[block] = map[uint64][]int{}
+	}
+	for _, result := range results {
+		fingerprint := uint64(result.doc.SimHash)
+		duplicateOf := -1
+		if fingerprint != 0 {
+		lookup:
+			for block := range buckets {
+				for _, i := range buckets[block][simHashBlock(fingerprint, block)] {
+					if isNearDuplicate(fingerprint, uint64(collapsed[i].doc.SimHash)) {
+						duplicateOf = i
+						break lookup
+					}
+				}
+			}
+		}
+		if duplicateOf != -1 {
+			collapsed[duplicateOf].Similar++
+			continue
+		}
+		if fingerprint != 0 {
+			for block := range buckets {
+				key := simHashBlock(fingerprint, block)
+				buckets[block][key] = append(buckets[block][key], len(collapsed))
+			}
+		}
+		collapsed = append(collapsed, result)
+	}
+	return collapsed
+}
@@ -0,0 +1,144 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSimHash(t *testing.T) {
+	// Create a sample article of a few hundred words
+	var words []string
+	for i := 0; i < 400; i++ {
+		words = append(words, fmt.Sprintf("word%d", (i*37+11)%211))
+	}
+	article := "Trail running shoes need grip on wet rock and mud. " + strings.Join(words, " ")
+	edited := append([]string{}, words...)
+	edited[200] = "changed"
+	rewritten := append([]string{}, words...)
+	for i := 0; i < len(rewritten); i += 3 {
+		rewritten[i] = "other"
+	}
+
+	// Define test cases
+	testCases := []struct {
+		name     string
+		text     string
+		expected bool
+	}{
+		{"same text", article, true},
+		{"same text in another case and spacing", strings.ToUpper(strings.ReplaceAll(article, " ", "  ")), true},
+		{"one word changed", "Trail running shoes need grip on wet rock and mud. " + strings.Join(edited, " "), true},
+		{"footer added", article + " Copyright 2024 Mirror site", true},
+		{"a third of the words changed", "Trail running shoes need grip on wet rock and mud. " + strings.Join(rewritten, " "), false},
+		{"another text", "Walking boots keep your feet dry on long hikes. " + strings.Join(words[:50], " "), false},
+		{"no text", "", false},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := isNearDuplicate(simHash(article), simHash(tc.text))
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("%s: Expected '%v', but got '%v'", tc.name, tc.expected, result)
+		}
+	}
+
+	// Texts too short to tell pages apart get no fingerprint, so they are never near-duplicates
+	shell := "Please enable JavaScript to run this app."
+	if simHash("shoes") != 0 || simHash(shell) != 0 || isNearDuplicate(simHash(shell), simHash(shell)) {
+		t.Errorf("Expected short texts to get no fingerprint, but got '%v' and '%v'", simHash("shoes"), simHash(shell))
+	}
+}
+
+func TestCollapseDuplicates(t *testing.T) {
+	// Fingerprints one bit apart are near-duplicates, those far apart or zero are not
+	results := []Result{
+		{Url: "https://example.com/original", Score: 4, doc: db.CrawledUrl{SimHash: 0x0f0f_0f0f_0f0f_0f0f}},
+		{Url: "https://other.com/unrelated", Score: 3, doc: db.CrawledUrl{SimHash: 0x7777_0000_1234_ffff}},
+		{Url: "https://mirror.com/copy", Score: 2, doc: db.CrawledUrl{SimHash: 0x0f0f_0f0f_0f0f_0f0e}},
+		{Url: "https://example.com/empty", Score: 2, doc: db.CrawledUrl{}},
+		{Url: "https://example.org/empty", Score: 1, doc: db.CrawledUrl{}},
+		{Url: "https://feed.com/syndicated", Score: 1, doc: db.CrawledUrl{SimHash: 0x0f0f_0f0f_0f0f_1f0f}},
+	}
+
+	collapsed := collapseDuplicates(results)
+
+	// Define test cases
+	testCases := []struct {
+		url     string
+		similar int
+	}{
+		{"https://example.com/original", 2},
+		{"https://other.com/unrelated", 0},
+		{"https://example.com/empty", 0},
+		{"https://example.org/empty", 0},
+	}
+
+	// Compare the number of results with the expected value
+	if len(collapsed) != len(testCases) {
+		t.Fatalf("Expected %d results, but got %d", len(testCases), len(collapsed))
+	}
+
+	// Iterate over test cases
+	for i, tc := range testCases {
+		// Compare the result with the expected value
+		if collapsed[i].Url != tc.url || collapsed[i].Similar != tc.similar {
+			t.Errorf("Expected '%v' with %d similar pages, but got '%v' with %d", tc.url, tc.similar, collapsed[i].Url, collapsed[i].Similar)
+		}
+	}
+}
+
+func TestMemIndexSearchCollapsesDuplicates(t *testing.T) {
+	m := NewMemIndex()
+	body := "Trail running shoes need grip on wet rock and mud, a light upper that drains water and a cushioned sole for long descents."
+	docs := []db.CrawledUrl{
+		{ID: "1", Url: "https://example.com/shoes", PageTitle: "Trail running shoes", BodyText: body, SimHash: int64(simHash(body))},
+		{ID: "2", Url: "https://mirror.com/shoes", PageTitle: "Shoes", BodyText: body, SimHash: int64(simHash(body))},
+		{ID: "3", Url: "https://example.org/boots", PageTitle: "Walking boots", BodyText: "Walking boots with running shoes comfort", SimHash: int64(simHash("Walking boots with running shoes comfort"))},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	m.Update(docs, idx)
+
+	root, _ := parseQuery("running shoes")
+	results := m.search(root, defaultBoosts)
+
+	// The mirror is collapsed into the better ranked copy
+	if len(results) != 2 || results[0].Url != "https://example.com/shoes" || results[0].Similar != 1 {
+		t.Errorf("Expected '%v' first with 1 similar page out of 2 results, but got '%v'", "https://example.com/shoes", results)
+	}
+}
+
+func TestMemIndexSetSimHash(t *testing.T) {
+	m := NewMemIndex()
+	body := "Trail running shoes need grip on wet rock and mud, a light upper that drains water and a cushioned sole for long descents."
+	// Both urls were indexed before fingerprints were stored
+	docs := []db.CrawledUrl{
+		{ID: "1", Url: "https://example.com/shoes", PageTitle: "Trail running shoes", BodyText: body},
+		{ID: "2", Url: "https://mirror.com/shoes", PageTitle: "Shoes", BodyText: body},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	m.Update(docs, idx)
+	root, _ := parseQuery("running shoes")
+	if results := m.search(root, defaultBoosts); len(results) != 2 {
+		t.Fatalf("Expected 2 results before the fingerprints are set, but got '%v'", results)
+	}
+
+	// Recrawling the unchanged urls sets their fingerprints, and a url that is not indexed is ignored
+	version := m.Version()
+	m.SetSimHash("1", int64(simHash(body)))
+	m.SetSimHash("2", int64(simHash(body)))
+	m.SetSimHash("3", int64(simHash(body)))
+	m.SetSimHash("2", int64(simHash(body)))
+	if m.Version() != version+2 {
+		t.Errorf("Expected version '%v', but got '%v'", version+2, m.Version())
+	}
+	results := m.search(root, defaultBoosts)
+	if len(results) != 1 || results[0].Similar != 1 {
+		t.Errorf("Expected 1 result with 1 similar page, but got '%v'", results)
+	}
+}
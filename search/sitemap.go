@@ -0,0 +1,298 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fiber-search-engine/db"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSitemapSize is the maximum number of bytes read from a sitemap once uncompressed, the limit set by the sitemap protocol.
+	maxSitemapSize = 50 * 1024 * 1024
+	// maxSitemaps is the maximum number of sitemaps fetched for a site, counting those listed in sitemap indexes.
+	maxSitemaps = 50
+	// defaultSitemapPriority is the priority of a sitemap url that does not set one.
+	defaultSitemapPriority = 0.5
+)
+
+// sitemapUrl is a url listed in a sitemap.
+type sitemapUrl struct {
+	loc      string
+	lastMod  *time.Time // When the page last changed, nil if the sitemap does not say
+	priority float64    // Importance of the page relative to the other pages of the site, from 0 to 1
+}
+
+// sitemapEntry is a <url> element of a urlset or a <sitemap> element of a sitemap index.
+type sitemapEntry struct {
+	Loc      string `xml:"loc"`
+	LastMod  string `xml:"lastmod"`
+	Priority string `xml:"priority"`
+}
+
+// lastModLayouts are the W3C datetime formats a sitemap lastmod may use.
+var lastModLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"}
+
+// parseSitemap is a function that parses a sitemap index or a urlset.
+// Gzipped sitemaps are recognised by their first bytes and uncompressed. The entries are decoded one at a time, and reading stops
+// after maxSize uncompressed bytes, keeping the entries read until then.
+// Missing or invalid priorities are replaced by defaultSitemapPriority, and lastmod values that cannot be parsed are ignored.
+//
+// Parameters:
+// body io.Reader: The contents of the sitemap, gzipped or not.
+// maxSize int64: The maximum number of uncompressed bytes read, maxSitemapSize for sitemaps fetched from a site.
+//
+// Returns:
+// []sitemapUrl: The urls listed in a urlset.
+// []string: The sitemaps listed in a sitemap index.
+// error: An error object if the body is not a sitemap or is not valid XML before the size limit.
+func parseSitemap(body io.Reader, maxSize int64) ([]sitemapUrl, []string, error) {
+	reader := bufio.NewReader(body)
+	if magic, err := reader.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		body = gz
+	} else {
+		body = reader
+	}
+	limited := &io.LimitedReader{R: body, N: maxSize}
+	decoder := xml.NewDecoder(limited)
+	root := ""
+	var urls []sitemapUrl
+	var sitemaps []string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF && root != "" {
+			break
+		}
+		if err != nil {
+			// A sitemap cut off by the size limit keeps the entries read before it
+			if limited.N == 0 && root != "" {
+				break
+			}
+			return nil, nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root == "" {
+			root = start.Name.Local
+			if root != "sitemapindex" && root != "urlset" {
+				return nil, nil, errors.New("not a sitemap: " + root)
+			}
+			continue
+		}
+		// Every element below the root is decoded whole, so the next start element is the next entry
+		var entry sitemapEntry
+		if err := decoder.DecodeElement(&entry, &start); err != nil {
+			if limited.N == 0 {
+				break
+			}
+			return nil, nil, err
+		}
+		loc := strings.TrimSpace(entry.Loc)
+		switch {
+		case loc == "":
+		case root == "sitemapindex" && start.Name.Local == "sitemap":
+			sitemaps = append(sitemaps, loc)
+		case root == "urlset" && start.Name.Local == "url":
+			urls = append(urls, sitemapUrl{loc: loc, lastMod: parseLastMod(entry.LastMod), priority: parsePriority(entry.Priority)})
+		}
+	}
+	return urls, sitemaps, nil
+}
+
+// parseLastMod returns the time of a sitemap lastmod value, or nil if it cannot be parsed.
+func parseLastMod(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// parsePriority returns the priority of a sitemap url, defaultSitemapPriority if it is missing or not a number from 0 to 1.
+func parsePriority(value string) float64 {
+	priority, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || priority < 0 || priority > 1 {
+		return defaultSitemapPriority
+	}
+	return priority
+}
+
+// frontierPriority turns a sitemap priority into a frontier priority, from -5 to 5.
+// The default sitemap priority maps to 0, the priority of the entry point of a site, so pages the site ranks higher are crawled before it.
+func frontierPriority(priority float64) int {
+	return int(math.Round((priority - defaultSitemapPriority) * 10))
+}
+
+// SiteOrigin is a function that turns a domain or url entered by an admin into the origin of the site, defaulting to https.
+// It is used to check the domain of a sitemap import before the import runs.
+//
+// Parameters:
+// domain string: A domain such as example.com or a url such as http://example.com/blog.
+//
+// Returns:
+// string: The scheme and host of the site, for example https://example.com.
+// error: An error object if no host can be found.
+func SiteOrigin(domain string) (string, error) {
+	domain = strings.TrimSpace(domain)
+	if !strings.Contains(domain, "://") {
+		domain = "https://" + domain
+	}
+	u, err := url.Parse(domain)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid domain %q", domain)
+	}
+	return u.Scheme + "://" + canonicalHost(u.Scheme, u.Host), nil
+}
+
+// discoverSitemaps is a function that fetches the sitemaps of a site and returns the urls they list.
+// The sitemaps listed in the site's robots.txt are fetched, along with /sitemap.xml, and so are the sitemaps listed in the sitemap indexes found,
+// up to maxSitemaps in total. Sitemaps the site's robots.txt does not allow are skipped, and requests wait for the host limiter.
+// The urls are normalized with canonicalUrl, and only urls on the host of the site are returned, each once, highest priority first.
+//
+// Parameters:
+// origin string: The scheme and host of the site, for example https://example.com.
+// limiter *hostLimiter: The limiter that enforces per-host politeness.
+//
+// Returns:
+// []sitemapUrl: The urls listed in the sitemaps of the site.
+func discoverSitemaps(origin string, limiter *hostLimiter) []sitemapUrl {
+	site, err := url.Parse(origin)
+	if err != nil {
+		return nil
+	}
+	host := canonicalHost(site.Scheme, site.Host)
+	queue := append(append([]string{}, getRobots(site).sitemaps...), origin+"/sitemap.xml")
+	fetched := map[string]bool{}
+	seen := map[string]bool{}
+	var urls []sitemapUrl
+	for len(queue) > 0 && len(fetched) < maxSitemaps {
+		next := queue[0]
+		queue = queue[1:]
+		if fetched[next] {
+			continue
+		}
+		fetched[next] = true
+		sitemapUrls, sitemaps, err := fetchSitemap(next, limiter)
+		if err != nil {
+			fmt.Printf("something went wrong fetching the sitemap %v: %v\n", next, err)
+			continue
+		}
+		queue = append(queue, sitemaps...)
+		for _, u := range sitemapUrls {
+			loc, err := canonicalUrl(u.loc)
+			if err != nil {
+				continue
+			}
+			u.loc = loc
+			if hostOf(u.loc) == host && !seen[u.loc] {
+				seen[u.loc] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	sort.SliceStable(urls, func(i, j int) bool {
+		return urls[i].priority > urls[j].priority
+	})
+	return urls
+}
+
+// fetchSitemap downloads and parses one sitemap, if the robots.txt of its host allows it.
+// Its redirects are checked and limited like those of a crawled page.
+func fetchSitemap(rawUrl string, limiter *hostLimiter) ([]sitemapUrl, []string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, nil, fmt.Errorf("invalid sitemap url")
+	}
+	rules := getRobots(u)
+	if !rules.allowed(u) {
+		return nil, nil, fmt.Errorf("disallowed by robots.txt")
+	}
+	host := strings.ToLower(u.Host)
+	limiter.acquire(host, rules.crawlDelay())
+	defer func() { limiter.release(host) }()
+	resp, err := fetch(rawUrl, politeRedirects(limiter, &host))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return parseSitemap(resp.Body, maxSitemapSize)
+}
+
+// sitemapFrontier is a function that turns the urls of a sitemap into new urls for the frontier and the lastmod of each url.
+// The new urls are one link away from the entry point of the site, with their frontier priority taken from their sitemap priority.
+//
+// Parameters:
+// urls []sitemapUrl: The urls listed in the sitemaps of a site.
+//
+// Returns:
+// []db.CrawledUrl: The urls to add to the frontier.
+// map[string]time.Time: The lastmod of every url that has one.
+func sitemapFrontier(urls []sitemapUrl) ([]db.CrawledUrl, map[string]time.Time) {
+	newUrls := make([]db.CrawledUrl, 0, len(urls))
+	lastMods := map[string]time.Time{}
+	for _, u := range urls {
+		newUrls = append(newUrls, db.CrawledUrl{Url: u.loc, Host: hostOf(u.loc), Depth: 1, Priority: frontierPriority(u.priority)})
+		if u.lastMod != nil {
+			lastMods[u.loc] = *u.lastMod
+		}
+	}
+	return newUrls, lastMods
+}
+
+// ImportSitemaps is a function that seeds the frontier with the urls listed in the sitemaps of a site.
+// The sitemaps are found by discoverSitemaps, sharing the host limiter of the crawl so an import running during a crawl
+// does not send a host more requests than the crawl settings allow. Urls that are not stored yet are added,
+// within the DomainPageBudget setting, and stored urls whose lastmod is after their last crawl are scheduled to be crawled again now.
+// It is run when an admin asks for it, so it adds urls even when the AddNew setting is off.
+//
+// Parameters:
+// domain string: The domain or url of the site, for example example.com.
+//
+// Returns:
+// int64: The number of urls added to the frontier.
+// error: An error object that describes an error that occurred during the function's execution.
+func ImportSitemaps(domain string) (int64, error) {
+	origin, err := SiteOrigin(domain)
+	if err != nil {
+		return 0, err
+	}
+	settings := &db.SearchSettings{}
+	if err := settings.Get(); err != nil {
+		return 0, err
+	}
+	limiter := sharedLimiter(*settings)
+	newUrls, lastMods := sitemapFrontier(discoverSitemaps(origin, limiter))
+	return seedFrontier(newUrls, lastMods, int64(settings.DomainPageBudget))
+}
+
+// seedFrontier adds urls from sitemaps to the frontier within the page budget of their host,
+// and schedules the stored urls modified since their last crawl to be crawled again now.
+func seedFrontier(newUrls []db.CrawledUrl, lastMods map[string]time.Time, budget int64) (int64, error) {
+	crawl := &db.CrawledUrl{}
+	if err := crawl.ScheduleModified(lastMods, time.Now()); err != nil {
+		return 0, err
+	}
+	return crawl.SaveNew(withinPageBudget(newUrls, budget, crawl.Stored, crawl.CountByHost))
+}
@@ -0,0 +1,255 @@
+package search
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSitemap(t *testing.T) {
+	urlset := `<?xml version="1.0" encoding="UTF-8"?>
+		<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<url><loc> https://example.com/ </loc><lastmod>2024-05-01</lastmod><priority>1.0</priority></url>
+			<url><loc>https://example.com/about</loc><lastmod>2024-05-01T10:30:00+02:00</lastmod></url>
+			<url><loc>https://example.com/old</loc><lastmod>yesterday</lastmod><priority>7</priority></url>
+			<url><loc></loc></url>
+		</urlset>`
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte(urlset))
+	_ = gz.Close()
+	index := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<sitemap><loc>https://example.com/posts.xml.gz</loc></sitemap>
+			<sitemap><loc>https://example.com/pages.xml</loc></sitemap>
+		</sitemapindex>`
+
+	// Define test cases
+	testCases := []struct {
+		name     string
+		body     []byte
+		urls     []string
+		sitemaps []string
+		err      bool
+	}{
+		{"urlset", []byte(urlset), []string{"https://example.com/", "https://example.com/about", "https://example.com/old"}, nil, false},
+		{"gzipped urlset", gzipped.Bytes(), []string{"https://example.com/", "https://example.com/about", "https://example.com/old"}, nil, false},
+		{"sitemap index", []byte(index), nil, []string{"https://example.com/posts.xml.gz", "https://example.com/pages.xml"}, false},
+		{"html page", []byte("<html><body>Not found</body></html>"), nil, nil, true},
+		{"not xml", []byte("User-agent: *"), nil, nil, true},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		urls, sitemaps, err := parseSitemap(bytes.NewReader(tc.body), maxSitemapSize)
+
+		// Compare the result with the expected value
+		if (err != nil) != tc.err {
+			t.Errorf("%s: Expected error '%v', but got '%v'", tc.name, tc.err, err)
+			continue
+		}
+		var locs []string
+		for _, u := range urls {
+			locs = append(locs, u.loc)
+		}
+		if !equalSlices(locs, tc.urls) {
+			t.Errorf("%s: Expected urls '%v', but got '%v'", tc.name, tc.urls, locs)
+		}
+		if !equalSlices(sitemaps, tc.sitemaps) {
+			t.Errorf("%s: Expected sitemaps '%v', but got '%v'", tc.name, tc.sitemaps, sitemaps)
+		}
+	}
+
+	// Compare the lastmod and priority of the parsed urls with the expected values
+	urls, _, _ := parseSitemap(strings.NewReader(urlset), maxSitemapSize)
+	if urls[0].lastMod == nil || !urls[0].lastMod.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected lastmod '%v', but got '%v'", "2024-05-01", urls[0].lastMod)
+	}
+	if urls[1].lastMod == nil || !urls[1].lastMod.Equal(time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected lastmod '%v', but got '%v'", "2024-05-01T08:30:00Z", urls[1].lastMod)
+	}
+	if urls[2].lastMod != nil {
+		t.Errorf("Expected no lastmod, but got '%v'", urls[2].lastMod)
+	}
+	if urls[0].priority != 1 || urls[1].priority != defaultSitemapPriority || urls[2].priority != defaultSitemapPriority {
+		t.Errorf("Expected priorities '%v', but got '%v'", []float64{1, 0.5, 0.5}, []float64{urls[0].priority, urls[1].priority, urls[2].priority})
+	}
+}
+
+// endlessUrlset is a urlset that never ends, listing https://example.com/0, https://example.com/1 and so on.
+type endlessUrlset struct {
+	pending []byte
+	next    int
+}
+
+func (e *endlessUrlset) Read(p []byte) (int, error) {
+	if len(e.pending) == 0 {
+		if e.next == 0 {
+			e.pending = []byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		}
+		e.pending = fmt.Appendf(e.pending, "<url><loc>https://example.com/%d</loc></url>", e.next)
+		e.next++
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+func TestParseSitemapSizeLimit(t *testing.T) {
+	// A sitemap larger than the limit keeps the urls read before it
+	urls, _, err := parseSitemap(&endlessUrlset{}, 64*1024)
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if len(urls) < 1000 || urls[0].loc != "https://example.com/0" || urls[len(urls)-1].loc != fmt.Sprintf("https://example.com/%d", len(urls)-1) {
+		t.Errorf("Expected the urls read before the limit, but got %d urls", len(urls))
+	}
+}
+
+func TestFrontierPriority(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		priority float64
+		expected int
+	}{
+		{1, 5},
+		{0.8, 3},
+		{0.5, 0},
+		{0.1, -4},
+		{0, -5},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := frontierPriority(tc.priority)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("Expected '%v', but got '%v'", tc.expected, result)
+		}
+	}
+}
+
+func TestSiteOrigin(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		domain   string
+		expected string
+		err      bool
+	}{
+		{"example.com", "https://example.com", false},
+		{" Example.com ", "https://example.com", false},
+		{"http://example.com:8080/blog?page=2", "http://example.com:8080", false},
+		{"ftp://example.com", "", true},
+		{"", "", true},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result, err := SiteOrigin(tc.domain)
+
+		// Compare the result with the expected value
+		if result != tc.expected || (err != nil) != tc.err {
+			t.Errorf("Expected '%v' with error '%v', but got '%v' with error '%v'", tc.expected, tc.err, result, err)
+		}
+	}
+}
+
+func TestDiscoverSitemaps(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private/\n\nSitemap: " + server.URL + "/index.xml\nSitemap: " + server.URL + "/private/sitemap.xml\n"))
+		case "/index.xml":
+			w.Write([]byte(`<sitemapindex>
+				<sitemap><loc>` + server.URL + `/posts.xml</loc></sitemap>
+				<sitemap><loc>` + server.URL + `/missing.xml</loc></sitemap>
+				<sitemap><loc>` + server.URL + `/index.xml</loc></sitemap>
+			</sitemapindex>`))
+		case "/posts.xml":
+			w.Write([]byte(`<urlset>
+				<url><loc>` + server.URL + `/posts/1</loc><priority>0.3</priority></url>
+				<url><loc>` + server.URL + `/posts/2</loc><priority>0.9</priority></url>
+				<url><loc>https://elsewhere.com/posts/3</loc></url>
+			</urlset>`))
+		case "/sitemap.xml":
+			w.Write([]byte(`<urlset>
+				<url><loc>` + server.URL + `/posts/1</loc></url>
+				<url><loc>` + server.URL + `/about</loc></url>
+			</urlset>`))
+		case "/private/sitemap.xml":
+			t.Error("expected the sitemap disallowed by robots.txt not to be fetched, but it was")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	urls := discoverSitemaps(server.URL, newHostLimiter(2, 0))
+	var locs []string
+	for _, u := range urls {
+		locs = append(locs, u.loc)
+	}
+
+	// Only urls on the site's host are kept, each once, highest priority first. The sitemaps listed in robots.txt and /sitemap.xml
+	// are read before the sitemaps of the index, so /posts/1 keeps the default priority it has in /sitemap.xml
+	expected := []string{server.URL + "/posts/2", server.URL + "/posts/1", server.URL + "/about"}
+	if !equalSlices(locs, expected) {
+		t.Errorf("Expected '%v', but got '%v'", expected, locs)
+	}
+}
+
+func TestFetchSitemapRedirect(t *testing.T) {
+	// Create a server whose sitemaps redirect to an allowed and a disallowed sitemap
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+		case "/moved.xml":
+			http.Redirect(w, r, "/sitemap.xml", http.StatusMovedPermanently)
+		case "/hidden.xml":
+			http.Redirect(w, r, "/private/sitemap.xml", http.StatusFound)
+		case "/sitemap.xml":
+			w.Write([]byte(`<urlset><url><loc>` + server.URL + `/about</loc></url></urlset>`))
+		case "/private/sitemap.xml":
+			t.Error("expected the sitemap disallowed by robots.txt not to be fetched, but it was")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// Define test cases
+	testCases := []struct {
+		path     string
+		expected int
+		err      error
+	}{
+		{"/moved.xml", 1, nil},
+		{"/hidden.xml", 0, errRedirectDisallowed},
+	}
+
+	// Iterate over test cases
+	limiter := newHostLimiter(1, 0)
+	for _, tc := range testCases {
+		urls, _, err := fetchSitemap(server.URL+tc.path, limiter)
+
+		// Compare the result with the expected value
+		if len(urls) != tc.expected || err != tc.err {
+			t.Errorf("For path '%s', expected %d urls with error '%v', but got %d with error '%v'", tc.path, tc.expected, tc.err, len(urls), err)
+		}
+	}
+
+	// The slot of the host is released once the sitemaps are read
+	for host, state := range limiter.hosts {
+		if state.inFlight != 0 {
+			t.Errorf("Expected no requests in flight to '%s', but got %d", host, state.inFlight)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package search
+
+import (
+	"errors"
+	"fiber-search-engine/db"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	snowballeng "github.com/kljensen/snowball/english"
+)
+
+// snippetWords is the number of words shown in a result snippet.
+const snippetWords = 30
+
+// snippetEllipsis marks a snippet that starts or ends in the middle of the field it was taken from.
+const snippetEllipsis = "…"
+
+// Markers wrap the matched terms of a snippet. They are inserted as they are, so they may hold HTML such as <mark> and </mark>.
+type Markers struct {
+	Pre  string
+	Post string
+}
+
+// defaultMarkers are used when the search settings cannot be loaded.
+var defaultMarkers = Markers{Pre: "<mark>", Post: "</mark>"}
+
+// markerTag matches an opening highlight tag the markers may use: one of a few inline elements, with an optional class.
+var markerTag = regexp.MustCompile(`^<(mark|b|strong|em|i|u|span)( class="[A-Za-z0-9 _-]*")?>$`)
+
+// errInvalidMarkers is returned by ValidateMarkers for markers outside the allowlist.
+var errInvalidMarkers = errors.New("highlight markers must be plain text or a <mark>, <b>, <strong>, <em>, <i>, <u> or <span> tag and its closing tag")
+
+// ValidateMarkers is a function that checks the highlight markers entered by an admin before they are saved.
+// Since markers are inserted into snippets without escaping, they are limited to an allowlist: either both are plain text
+// without HTML special characters, or the first is the opening tag of an inline element, with at most a class attribute,
+// and the second is its closing tag.
+//
+// Parameters:
+// pre string: The marker inserted before a matched term.
+// post string: The marker inserted after a matched term.
+//
+// Returns:
+// error: An error object if the markers are not allowed.
+func ValidateMarkers(pre string, post string) error {
+	if html.EscapeString(pre) == pre && html.EscapeString(post) == post {
+		return nil
+	}
+	if tag := markerTag.FindStringSubmatch(pre); tag != nil && post == "</"+tag[1]+">" {
+		return nil
+	}
+	return errInvalidMarkers
+}
+
+// settingsMarkers returns the highlight markers configured in the search settings.
+func settingsMarkers(settings db.SearchSettings) Markers {
+	return Markers{Pre: settings.HighlightPre, Post: settings.HighlightPost}
+}
+
+// snippetFields are the fields snippets are taken from, in order of preference when several match equally well.
+var snippetFields = []field{fieldDescription, fieldHeadings, fieldBody}
+
+// wordSpan is the byte range of a word in a text and the token it analyzes to, empty for stopwords.
+type wordSpan struct {
+	start, end int
+	token      string
+}
+
+// makeSnippet is a function that builds a short extract of a url explaining why it matched a search.
+// It looks at the description, the headings and the body text and picks the window of snippetWords words
+// holding the most distinct search terms, preferring the earliest field and position on a tie.
+// Words are matched by analyzing them like the indexed text, so "Running" is highlighted for a search on "run".
+// The text of the snippet is HTML escaped and every matched word is wrapped in the markers, which are not escaped.
+// When no field contains a search term, the start of the description, or of the body text if there is no description, is used.
+//
+// Parameters:
+// doc db.CrawledUrl: The url to build the snippet from.
+// tokens map[string]bool: The analyzed tokens of the search terms.
+// markers Markers: The markers to wrap matched words in.
+//
+// Returns:
+// string: The snippet, safe to insert into HTML, or an empty string if the url has no text to show.
+func makeSnippet(doc db.CrawledUrl, tokens map[string]bool, markers Markers) string {
+	texts := fieldTexts(doc)
+	bestText, bestWords, bestStart, bestHits := "", []wordSpan(nil), 0, 0
+	for _, f := range snippetFields {
+		words := splitWords(texts[f])
+		start, hits := bestWindow(words, tokens)
+		if hits > bestHits {
+			bestText, bestWords, bestStart, bestHits = texts[f], words, start, hits
+		}
+	}
+	if bestHits == 0 {
+		for _, f := range []field{fieldDescription, fieldBody} {
+			if words := splitWords(texts[f]); len(words) > 0 {
+				bestText, bestWords, bestStart = texts[f], words, 0
+				break
+			}
+		}
+	}
+	if len(bestWords) == 0 {
+		return ""
+	}
+	return renderSnippet(bestText, bestWords[bestStart:min(bestStart+snippetWords, len(bestWords))], bestStart > 0, bestStart+snippetWords < len(bestWords), tokens, markers)
+}
+
+// splitWords returns the words of a text, split the same way as tokenize, with the token each word analyzes to.
+func splitWords(text string) []wordSpan {
+	var words []wordSpan
+	start := -1
+	for i, r := range text + " " {
+		isWord := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			word := strings.ToLower(text[start:i])
+			token := ""
+			if _, ok := stopwords[word]; !ok {
+				token = snowballeng.Stem(word, false)
+			}
+			words = append(words, wordSpan{start: start, end: i, token: token})
+			start = -1
+		}
+	}
+	return words
+}
+
+// bestWindow returns the first word of the window of snippetWords words with the most distinct search terms, and how many it has.
+// The window is then moved so the terms it holds sit in its middle.
+func bestWindow(words []wordSpan, tokens map[string]bool) (int, int) {
+	counts := map[string]int{}
+	best, bestHits := 0, 0
+	for i, word := range words {
+		if tokens[word.token] {
+			counts[word.token]++
+		}
+		// Drop the word that slid out of the window
+		if out := i - snippetWords; out >= 0 && tokens[words[out].token] {
+			counts[words[out].token]--
+			if counts[words[out].token] == 0 {
+				delete(counts, words[out].token)
+			}
+		}
+		if len(counts) > bestHits {
+			best, bestHits = max(i-snippetWords+1, 0), len(counts)
+		}
+	}
+	if bestHits == 0 {
+		return 0, 0
+	}
+	// Center the terms in the window so they are shown with the words around them
+	first, last := -1, -1
+	for i := best; i < min(best+snippetWords, len(words)); i++ {
+		if tokens[words[i].token] {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	slack := snippetWords - (last - first + 1)
+	best = max(min(first-slack/2, len(words)-snippetWords), 0)
+	return best, bestHits
+}
+
+// renderSnippet writes the words of a window as escaped HTML, wrapping the search terms in the markers.
+// The text between two words is kept, with runs of whitespace collapsed to a single space,
+// and so is the text before the first word and after the last word of the field when the window reaches them.
+func renderSnippet(text string, words []wordSpan, cutStart bool, cutEnd bool, tokens map[string]bool, markers Markers) string {
+	var b strings.Builder
+	if cutStart {
+		b.WriteString(snippetEllipsis)
+	}
+	if !cutStart {
+		b.WriteString(html.EscapeString(strings.TrimLeftFunc(collapseSpace(text[:words[0].start]), unicode.IsSpace)))
+	}
+	for i, word := range words {
+		if i > 0 {
+			b.WriteString(html.EscapeString(collapseSpace(text[words[i-1].end:word.start])))
+		}
+		if tokens[word.token] {
+			b.WriteString(markers.Pre)
+			b.WriteString(html.EscapeString(text[word.start:word.end]))
+			b.WriteString(markers.Post)
+		} else {
+			b.WriteString(html.EscapeString(text[word.start:word.end]))
+		}
+	}
+	if cutEnd {
+		b.WriteString(snippetEllipsis)
+	} else {
+		b.WriteString(html.EscapeString(strings.TrimRightFunc(collapseSpace(text[words[len(words)-1].end:]), unicode.IsSpace)))
+	}
+	return b.String()
+}
+
+// collapseSpace replaces every run of whitespace in a string with a single space.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"strings"
+	"testing"
+)
+
+func TestMakeSnippet(t *testing.T) {
+	markers := Markers{Pre: "[", Post: "]"}
+	longBody := strings.Repeat("filler ", 40) + "the running shoes we sell" + strings.Repeat(" filler", 40)
+
+	// Define test cases
+	testCases := []struct {
+		doc      db.CrawledUrl
+		query    []string
+		expected string
+	}{
+		// Matched words are wrapped in the markers, whatever their form
+		{db.CrawledUrl{PageDescription: "Running shoes for the road."}, []string{"run"}, "[Running] shoes for the road."},
+		// HTML in the text is escaped but the markers are not
+		{db.CrawledUrl{PageDescription: `<script>alert("shoes")</script> & more`}, []string{"shoe"}, `&lt;script&gt;alert(&#34;[shoes]&#34;)&lt;/script&gt; &amp; more`},
+		// Whitespace between words is collapsed
+		{db.CrawledUrl{PageDescription: "Trail\n\n   running"}, []string{"run"}, "Trail [running]"},
+		// The field with the most distinct terms is used
+		{db.CrawledUrl{PageDescription: "Shoes", Headings: "Running shoes"}, []string{"run", "shoe"}, "[Running] [shoes]"},
+		// A window is cut from a long field around the terms
+		{db.CrawledUrl{BodyText: longBody}, []string{"run", "shoe"}, "…" + strings.Repeat("filler ", 13) + "the [running] [shoes] we sell" + strings.Repeat(" filler", 12) + "…"},
+		// Without a match the start of the description is used
+		{db.CrawledUrl{PageDescription: "A page about boots", BodyText: "Body"}, []string{"shoe"}, "A page about boots"},
+		{db.CrawledUrl{}, []string{"shoe"}, ""},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		tokens := map[string]bool{}
+		for _, token := range tc.query {
+			tokens[token] = true
+		}
+		result := makeSnippet(tc.doc, tokens, markers)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For query '%v', expected '%s', but got '%s'", tc.query, tc.expected, result)
+		}
+	}
+}
+
+func TestValidateMarkers(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		pre      string
+		post     string
+		expected bool
+	}{
+		{"<mark>", "</mark>", true},
+		{"<strong>", "</strong>", true},
+		{`<span class="hit text-primary">`, "</span>", true},
+		{"[", "]", true},
+		{"", "", true},
+		{"<b>", "</strong>", false},
+		{"<mark>", "", false},
+		{`<span onmouseover="alert(1)">`, "</span>", false},
+		{"<script>", "</script>", false},
+		{`<img src=x onerror=alert(1)>`, "", false},
+		{"<mark>", "</mark><script>alert(1)</script>", false},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := ValidateMarkers(tc.pre, tc.post) == nil
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For markers '%s' and '%s', expected '%v', but got '%v'", tc.pre, tc.post, tc.expected, result)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// lowResultThreshold is the number of results below which a query is checked for spelling mistakes.
+const lowResultThreshold = 3
+
+// correctionRatio is how many times more frequent than a word a correction must be to replace a word that is in the index.
+const correctionRatio = 10
+
+// minCorrectedWordSize is the length of the shortest word corrected. Shorter words have too many close neighbours.
+const minCorrectedWordSize = 3
+
+// maxEdits returns the number of edits allowed when correcting a word: one for short words and two for longer ones.
+func maxEdits(word string) int {
+	if len(word) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// correctQuery is a function that suggests a spelling correction for a search query.
+// Every word of the query's terms and phrases is compared with the vocabulary of the index, and replaced by the closest word
+// within maxEdits edits when its tokens match no indexed url, or when the correction is correctionRatio times more frequent.
+// Among the words at the same distance, the most frequent one is chosen. Operators, field qualifiers, site: values
+// and stopwords are kept as they are, and so is the rest of the query.
+//
+// Parameters:
+// query string: The search query.
+// vocabulary *trie: The words of the index with their frequencies.
+// m *MemIndex: The index used to find out which words match no url.
+//
+// Returns:
+// string: The corrected query, or an empty string if no word needs correcting.
+func correctQuery(query string, vocabulary *trie, m *MemIndex) string {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return ""
+	}
+	type replacement struct {
+		start, end int
+		word       string
+	}
+	var replacements []replacement
+	for i, t := range tokens {
+		offset := t.pos
+		switch {
+		case t.kind == tokenPhrase:
+			offset++
+		case t.kind != tokenWord:
+			continue
+		case i > 0 && tokens[i-1].kind == tokenField && tokens[i-1].text == "site":
+			continue
+		}
+		for _, span := range splitWords(t.text) {
+			word := strings.ToLower(t.text[span.start:span.end])
+			if span.token == "" || len(word) < minCorrectedWordSize {
+				continue
+			}
+			if correction := correctWord(word, span.token, vocabulary, m); correction != "" {
+				replacements = append(replacements, replacement{offset + span.start, offset + span.end, correction})
+			}
+		}
+	}
+	if len(replacements) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	last := 0
+	for _, r := range replacements {
+		b.WriteString(query[last:r.start])
+		b.WriteString(r.word)
+		last = r.end
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// correctWord returns the correction of a word, or an empty string if it needs none.
+func correctWord(word string, token string, vocabulary *trie, m *MemIndex) string {
+	frequency := vocabulary.frequency(word)
+	m.mu.RLock()
+	found := len(m.postings[token]) > 0
+	m.mu.RUnlock()
+
+	matches := vocabulary.within(word, maxEdits(word))
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		if matches[i].Frequency != matches[j].Frequency {
+			return matches[i].Frequency > matches[j].Frequency
+		}
+		return matches[i].Text < matches[j].Text
+	})
+	for _, match := range matches {
+		if match.Text == word {
+			continue
+		}
+		if !found || match.Frequency >= correctionRatio*frequency {
+			return match.Text
+		}
+		return ""
+	}
+	return ""
+}
+
+// didYouMean is a function that suggests a corrected query for a search that found fewer than lowResultThreshold results.
+// The correction is only suggested when it finds more results than the query itself.
+//
+// Parameters:
+// query string: The search query.
+// total int: The number of results of the query.
+// boosts [numFields]float64: The field boosts used to run the corrected query.
+//
+// Returns:
+// string: The corrected query, or an empty string if there is none.
+func didYouMean(query string, total int, boosts [numFields]float64) string {
+	if total >= lowResultThreshold {
+		return ""
+	}
+	suggestions.mu.RLock()
+	corrected := correctQuery(query, suggestions.trie, memIndex)
+	suggestions.mu.RUnlock()
+	if corrected == "" {
+		return ""
+	}
+	root, err := parseQuery(corrected)
+	if err != nil || len(memIndex.search(memIndex.expandFuzzy(root), boosts)) <= total {
+		return ""
+	}
+	return corrected
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"testing"
+)
+
+func TestCorrectQuery(t *testing.T) {
+	m := NewMemIndex()
+	docs := []db.CrawledUrl{
+		{ID: "1", Url: "https://example.com", PageTitle: "Running shoes", PageDescription: "Programming in Go"},
+		{ID: "2", Url: "https://example.org", PageTitle: "Running shorts", PageDescription: "Programming in Rust"},
+		{ID: "3", Url: "https://example.net", PageTitle: "Trail runners", PageDescription: "Programing notes"},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	m.Update(docs, idx)
+	vocabulary := m.suggestionTrie()
+	vocabulary.finish()
+
+	// Define test cases
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		// Words matching no url are replaced by the closest and most frequent word
+		{"runnign shoes", "running shoes"},
+		{"title:shoez -\"runing shorts\"", "title:shoes -\"running shorts\""},
+		// Words in the index are kept unless the correction is much more frequent
+		{"programing", ""},
+		{"running shoes", ""},
+		// Operators, site: values, stopwords and short words are kept
+		{"shoez OR site:exampel.com", "shoes OR site:exampel.com"},
+		{"teh shoez", "teh shoes"},
+		{"xyzzy", ""},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := correctQuery(tc.query, vocabulary, m)
+
+		// Compare the result with the expected value
+		if result != tc.expected {
+			t.Errorf("For query '%s', expected '%s', but got '%s'", tc.query, tc.expected, result)
+		}
+	}
+}
+
+func TestTrieWithin(t *testing.T) {
+	tr := newTrie(MaxSuggestions)
+	for _, word := range []string{"shoe", "shoes", "shop", "show", "shorts", "running shoes"} {
+		tr.insert(word, 1)
+	}
+	tr.finish()
+
+	// Define test cases
+	testCases := []struct {
+		word     string
+		distance int
+		expected map[string]int
+	}{
+		{"shoe", 0, map[string]int{"shoe": 0}},
+		{"shoe", 1, map[string]int{"shoe": 0, "shoes": 1, "shop": 1, "show": 1}},
+		{"shots", 1, map[string]int{"shoes": 1, "shorts": 1}},
+		// Past queries with several words are not matched
+		{"runningshoes", 1, map[string]int{}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := map[string]int{}
+		for _, match := range tr.within(tc.word, tc.distance) {
+			result[match.Text] = match.distance
+		}
+
+		// Compare the result with the expected value
+		if len(result) != len(tc.expected) {
+			t.Errorf("For '%s', expected '%v', but got '%v'", tc.word, tc.expected, result)
+			continue
+		}
+		for word, distance := range tc.expected {
+			if d, ok := result[word]; !ok || d != distance {
+				t.Errorf("For '%s', expected '%v', but got '%v'", tc.word, tc.expected, result)
+				break
+			}
+		}
+	}
+}
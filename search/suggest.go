@@ -0,0 +1,177 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Numbers of suggestions returned for a prefix.
+const (
+	DefaultSuggestions = 5  // Suggestions returned when the request does not ask for a number
+	MaxSuggestions     = 10 // Largest number of suggestions returned at once
+)
+
+// popularQueryLimit is the number of most searched for queries suggested.
+const popularQueryLimit = 10000
+
+// minPopularQueryCount is the number of times a query must have been searched for before it is suggested to everyone.
+const minPopularQueryCount = 3
+
+// maxSuggestedWordSize is the length in bytes of the longest word suggested, leaving out long runs of letters that are not words.
+const maxSuggestedWordSize = 32
+
+// suggestions holds the trie prefixes are completed from, and the searches recorded since it was built.
+var suggestions = struct {
+	mu       sync.RWMutex
+	trie     *trie
+	countsMu sync.Mutex
+	counts   map[string]int // Searches for each query not yet saved to the database
+}{trie: newTrie(MaxSuggestions), counts: map[string]int{}}
+
+// RecordQuery is a function that counts a search for a query, so queries searched for often are suggested.
+// The counts are kept in memory and saved to the database by RefreshSuggestions.
+//
+// Parameters:
+// query string: The query searched for.
+//
+// This function does not return any values.
+func RecordQuery(query string) {
+	query = normalizeSuggestion(query)
+	if query == "" {
+		return
+	}
+	suggestions.countsMu.Lock()
+	defer suggestions.countsMu.Unlock()
+	suggestions.counts[query]++
+}
+
+// RefreshSuggestions is a function that rebuilds the trie prefixes are completed from.
+// It saves the searches recorded since the last refresh, then builds the trie from the words of the urls in the in-memory index,
+// weighted by the number of urls containing them, and from the most popular past queries searched for at least minPopularQueryCount times, weighted by the number of times they were searched for.
+// The trie is built aside and swapped in when complete, so suggestions keep being served meanwhile.
+//
+// This function does not take any parameters.
+//
+// Returns:
+// error: An error object that describes an error that occurred during the function's execution.
+func RefreshSuggestions() error {
+	suggestions.countsMu.Lock()
+	counts := suggestions.counts
+	suggestions.counts = map[string]int{}
+	suggestions.countsMu.Unlock()
+
+	searchQuery := &db.SearchQuery{}
+	if err := searchQuery.AddCounts(counts); err != nil {
+		// Keep the counts for the next refresh
+		suggestions.countsMu.Lock()
+		for query, count := range counts {
+			suggestions.counts[query] += count
+		}
+		suggestions.countsMu.Unlock()
+		return err
+	}
+	popular, err := searchQuery.GetPopular(popularQueryLimit, minPopularQueryCount)
+	if err != nil {
+		return err
+	}
+
+	t := memIndex.suggestionTrie()
+	for _, query := range popular {
+		t.insert(query.Query, query.Count)
+	}
+	t.finish()
+
+	suggestions.mu.Lock()
+	defer suggestions.mu.Unlock()
+	suggestions.trie = t
+	return nil
+}
+
+// Suggest is a function that completes a search prefix with the most frequent words and past queries starting with it.
+// When the prefix has several words and there are not enough completions of the whole prefix,
+// the last word is completed on its own and the words before it are kept.
+//
+// Parameters:
+// prefix string: The start of a query.
+// limit int: The number of suggestions to return, or zero for DefaultSuggestions. It is capped at MaxSuggestions.
+//
+// Returns:
+// []Suggestion: The suggestions, most frequent first.
+func Suggest(prefix string, limit int) []Suggestion {
+	if limit <= 0 {
+		limit = DefaultSuggestions
+	}
+	limit = min(limit, MaxSuggestions)
+	trailingSpace := strings.TrimRightFunc(prefix, unicode.IsSpace) != prefix
+	prefix = normalizeSuggestion(prefix)
+	if prefix == "" {
+		return []Suggestion{}
+	}
+	if trailingSpace {
+		prefix += " "
+	}
+
+	suggestions.mu.RLock()
+	defer suggestions.mu.RUnlock()
+	result := append([]Suggestion{}, suggestions.trie.complete(prefix, limit)...)
+	head, last, ok := cutLast(prefix)
+	if !ok || last == "" || len(result) >= limit {
+		return result
+	}
+	seen := map[string]bool{}
+	for _, s := range result {
+		seen[s.Text] = true
+	}
+	for _, s := range suggestions.trie.complete(last, MaxSuggestions) {
+		text := head + " " + s.Text
+		if len(result) < limit && !seen[text] {
+			result = append(result, Suggestion{Text: text, Frequency: s.Frequency})
+			seen[text] = true
+		}
+	}
+	return result
+}
+
+// cutLast splits a prefix at its last space, returning the words before it and the last word.
+func cutLast(prefix string) (string, string, bool) {
+	i := strings.LastIndexByte(prefix, ' ')
+	if i < 0 {
+		return "", prefix, false
+	}
+	return prefix[:i], prefix[i+1:], true
+}
+
+// normalizeSuggestion lowercases a query and collapses its whitespace, so the same query typed differently is counted once.
+func normalizeSuggestion(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// suggestionTrie returns a trie of the words of the indexed urls, each weighted by the number of urls containing it.
+// Stopwords, single letters and the words of the url itself are left out. The trie is not finished, so more words can be inserted.
+func (m *MemIndex) suggestionTrie() *trie {
+	t := newTrie(MaxSuggestions)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, doc := range m.docs {
+		words := map[string]bool{}
+		for f, text := range fieldTexts(doc) {
+			// The scheme and domain parts of urls are not words people search for
+			if field(f) == fieldUrl {
+				continue
+			}
+			for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+			}) {
+				if _, ok := stopwords[word]; !ok && len(word) > 1 && len(word) <= maxSuggestedWordSize {
+					words[word] = true
+				}
+			}
+		}
+		for word := range words {
+			t.insert(word, 1)
+		}
+	}
+	return t
+}
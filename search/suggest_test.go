@@ -0,0 +1,112 @@
+package search
+
+import (
+	"fiber-search-engine/db"
+	"reflect"
+	"testing"
+)
+
+func TestTrieComplete(t *testing.T) {
+	tr := newTrie(3)
+	for word, frequency := range map[string]int{"run": 5, "running": 3, "runner": 3, "rust": 4, "ruby": 1, "go": 2} {
+		tr.insert(word, frequency)
+	}
+	tr.insert("ruby", 1)
+	tr.finish()
+
+	// Define test cases
+	testCases := []struct {
+		prefix   string
+		limit    int
+		expected []string
+	}{
+		{"run", 5, []string{"run", "runner", "running"}},
+		// Nodes only keep their 3 most frequent words
+		{"r", 5, []string{"run", "rust", "runner"}},
+		{"r", 2, []string{"run", "rust"}},
+		{"rub", 5, []string{"ruby"}},
+		{"java", 5, []string{}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := []string{}
+		for _, s := range tr.complete(tc.prefix, tc.limit) {
+			result = append(result, s.Text)
+		}
+
+		// Compare the result with the expected value
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("For prefix '%s', expected '%v', but got '%v'", tc.prefix, tc.expected, result)
+		}
+	}
+}
+
+func TestTrieRemove(t *testing.T) {
+	tr := newTrie(3)
+	for word, frequency := range map[string]int{"run": 5, "running": 3, "runner": 3, "go": 2} {
+		tr.insert(word, frequency)
+	}
+	tr.remove("running")
+	tr.remove("go")
+	tr.remove("missing")
+	tr.finish()
+
+	// The nodes of removed words are dropped, and the nodes shared with other words are kept
+	if _, ok := tr.root.children['g']; ok {
+		t.Errorf("Expected the nodes of 'go' to be removed, but got '%v'", tr.root.children['g'])
+	}
+	if node := tr.root.children['r'].children['u'].children['n'].children['n']; node == nil || len(node.children) != 1 || node.children['e'] == nil {
+		t.Errorf("Expected only the nodes of 'runner' to be kept below 'runn', but got '%v'", node)
+	}
+
+	// Removing a word that is the prefix of another keeps the other
+	tr.remove("run")
+	tr.finish()
+	result := []string{}
+	for _, s := range tr.complete("r", 5) {
+		result = append(result, s.Text)
+	}
+	if expected := []string{"runner"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected '%v', but got '%v'", expected, result)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	m := NewMemIndex()
+	m.addDoc(db.CrawledUrl{ID: "1", Url: "https://shoes.example.com", PageTitle: "Running shoes", BodyText: "The best running shoes"})
+	m.addDoc(db.CrawledUrl{ID: "2", Url: "https://example.org", PageTitle: "Running shorts"})
+	m.addDoc(db.CrawledUrl{ID: "3", Url: "https://example.net", PageTitle: "Trail runners"})
+	tr := m.suggestionTrie()
+	tr.insert("running shoes for women", 4)
+	tr.finish()
+	previous := suggestions.trie
+	suggestions.trie = tr
+	defer func() { suggestions.trie = previous }()
+
+	// Define test cases
+	testCases := []struct {
+		prefix   string
+		expected []Suggestion
+	}{
+		// Words are weighted by the number of urls containing them
+		{"Run", []Suggestion{{"running shoes for women", 4}, {"running", 2}, {"runners", 1}}},
+		// Past queries complete the whole prefix, then the last word is completed on its own
+		{"running  sho", []Suggestion{{"running shoes for women", 4}, {"running shoes", 1}, {"running shorts", 1}}},
+		{"trail ", []Suggestion{}},
+		// Stopwords and the words of the url are not suggested
+		{"the", []Suggestion{}},
+		{"exam", []Suggestion{}},
+		{"", []Suggestion{}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := Suggest(tc.prefix, 0)
+
+		// Compare the result with the expected value
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("For prefix '%s', expected '%v', but got '%v'", tc.prefix, tc.expected, result)
+		}
+	}
+}
@@ -16,6 +16,22 @@ func analyze(text string) []string {
 	return tokens
 }
 
+// analyzePositions analyzes the text like analyze and also returns the word position of every token.
+// Positions count every word of the text, including the stopwords that are removed,
+// so two words separated by a stopword are not next to each other.
+func analyzePositions(text string) ([]string, []int) {
+	var tokens []string
+	var positions []int
+	for i, word := range lowercaseFilter(tokenize(text)) {
+		if _, ok := stopwords[word]; ok {
+			continue
+		}
+		tokens = append(tokens, snowballeng.Stem(word, false))
+		positions = append(positions, i)
+	}
+	return tokens, positions
+}
+
 // tokenize returns a slice of tokens for the given text.
 func tokenize(text string) []string {
 	return strings.FieldsFunc(text, func(r rune) bool {
@@ -33,19 +49,21 @@ func lowercaseFilter(tokens []string) []string {
 	return r
 }
 
+// stopwords are common words that carry too little meaning to be indexed.
+var stopwords = map[string]struct{}{
+	"a": {}, "and": {}, "be": {}, "have": {}, "i": {},
+	"in": {}, "of": {}, "that": {}, "the": {}, "to": {},
+	"it": {}, "for": {}, "not": {}, "on": {}, "with": {},
+	"as": {}, "you": {}, "do": {}, "at": {}, "this": {},
+	"but": {}, "his": {}, "by": {}, "from": {}, "they": {},
+	"we": {}, "say": {}, "her": {}, "she": {}, "or": {},
+	"an": {}, "will": {}, "my": {}, "one": {}, "all": {},
+	"www": {}, "com": {}, "org": {}, "net": {}, "io": {},
+	"https": {}, "http": {}, "html": {}, "php": {}, "asp": {}, "co": {},
+}
+
 // stopwordFilter returns a slice of tokens with stop words removed.
 func stopwordFilter(tokens []string) []string {
-	var stopwords = map[string]struct{}{
-		"a": {}, "and": {}, "be": {}, "have": {}, "i": {},
-		"in": {}, "of": {}, "that": {}, "the": {}, "to": {},
-		"it": {}, "for": {}, "not": {}, "on": {}, "with": {},
-		"as": {}, "you": {}, "do": {}, "at": {}, "this": {},
-		"but": {}, "his": {}, "by": {}, "from": {}, "they": {},
-		"we": {}, "say": {}, "her": {}, "she": {}, "or": {},
-		"an": {}, "will": {}, "my": {}, "one": {}, "all": {},
-		"www": {}, "com": {}, "org": {}, "net": {}, "io": {},
-		"https": {}, "http": {}, "html": {}, "php": {}, "asp": {}, "co": {},
-	}
 	r := make([]string, 0, len(tokens))
 	for _, token := range tokens {
 		if _, ok := stopwords[token]; !ok {
@@ -63,3 +81,16 @@ func stemmerFilter(tokens []string) []string {
 	}
 	return r
 }
+
+// uniqueTokens returns the tokens with duplicates removed, keeping the first occurrence of each.
+func uniqueTokens(tokens []string) []string {
+	seen := make(map[string]struct{}, len(tokens))
+	r := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if _, ok := seen[token]; !ok {
+			seen[token] = struct{}{}
+			r = append(r, token)
+		}
+	}
+	return r
+}
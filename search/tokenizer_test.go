@@ -0,0 +1,54 @@
+package search
+
+import "testing"
+
+func TestAnalyze(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		text     string
+		expected []string
+	}{
+		{"Running", []string{"run"}},
+		{"The Runner runs!", []string{"runner", "run"}},
+		{"https://www.example.com/Go-Programming", []string{"exampl", "go", "program"}},
+		{"a and the", []string{}},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		result := analyze(tc.text)
+
+		// Compare the result with the expected value
+		if !equalSlices(result, tc.expected) {
+			t.Errorf("For text '%s', expected '%v', but got '%v'", tc.text, tc.expected, result)
+		}
+	}
+}
+
+func TestUniqueTokens(t *testing.T) {
+	expected := []string{"run", "shoe"}
+	result := uniqueTokens([]string{"run", "shoe", "run"})
+	if !equalSlices(result, expected) {
+		t.Errorf("Expected '%v', but got '%v'", expected, result)
+	}
+}
+
+func TestAnalyzePositions(t *testing.T) {
+	tokens, positions := analyzePositions("The war of the Worlds, running")
+
+	// Stopwords are dropped but still counted in the positions
+	expectedTokens := []string{"war", "world", "run"}
+	if !equalSlices(tokens, expectedTokens) {
+		t.Errorf("Expected '%v', but got '%v'", expectedTokens, tokens)
+	}
+	expectedPositions := []int{1, 4, 5}
+	if len(positions) != len(expectedPositions) {
+		t.Fatalf("Expected '%v', but got '%v'", expectedPositions, positions)
+	}
+	for i := range positions {
+		if positions[i] != expectedPositions[i] {
+			t.Errorf("Expected '%v', but got '%v'", expectedPositions, positions)
+			break
+		}
+	}
+}
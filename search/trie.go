@@ -0,0 +1,170 @@
+package search
+
+import "sort"
+
+// Suggestion is a completion of a search prefix.
+type Suggestion struct {
+	Text      string `json:"text"`
+	Frequency int    `json:"frequency"` // Number of indexed urls containing the word, plus the number of times it was searched for
+}
+
+// trie is a prefix tree of words and their frequencies.
+// Once built, every node keeps the most frequent words below it, so completing a prefix only walks down the prefix.
+type trie struct {
+	root *trieNode
+	size int // Number of words kept by each node
+}
+
+// trieNode is a node of a trie. The path from the root to the node spells a prefix.
+type trieNode struct {
+	children  map[byte]*trieNode
+	word      string       // The word ending at this node, empty if none does
+	frequency int          // Frequency of the word ending at this node
+	top       []Suggestion // The most frequent words starting with the prefix, most frequent first
+}
+
+// newTrie returns an empty trie whose nodes keep their size most frequent words.
+func newTrie(size int) *trie {
+	return &trie{root: &trieNode{}, size: size}
+}
+
+// insert adds a word to the trie, adding frequency to it if it is already there. finish must be called once every word is inserted.
+func (t *trie) insert(word string, frequency int) {
+	node := t.root
+	for i := 0; i < len(word); i++ {
+		if node.children == nil {
+			node.children = map[byte]*trieNode{}
+		}
+		child, ok := node.children[word[i]]
+		if !ok {
+			child = &trieNode{}
+			node.children[word[i]] = child
+		}
+		node = child
+	}
+	node.word = word
+	node.frequency += frequency
+}
+
+// remove takes a word out of the trie, along with the nodes left without a word below them.
+// finish must be called again before completing prefixes.
+func (t *trie) remove(word string) {
+	t.root.remove(word, 0)
+}
+
+// remove takes the word out of the node at depth i of its path and reports whether the node is left empty,
+// so its parent can drop it.
+func (n *trieNode) remove(word string, i int) bool {
+	if i == len(word) {
+		n.word = ""
+		n.frequency = 0
+	} else if child := n.children[word[i]]; child != nil && child.remove(word, i+1) {
+		delete(n.children, word[i])
+	}
+	return n.word == "" && len(n.children) == 0
+}
+
+// finish computes the most frequent words below every node.
+func (t *trie) finish() {
+	t.root.finish(t.size)
+}
+
+// finish computes the most frequent words below the node from those of its children.
+func (n *trieNode) finish(size int) {
+	n.top = nil
+	if n.word != "" {
+		n.top = append(n.top, Suggestion{Text: n.word, Frequency: n.frequency})
+	}
+	for _, child := range n.children {
+		child.finish(size)
+		n.top = append(n.top, child.top...)
+	}
+	sortSuggestions(n.top)
+	if len(n.top) > size {
+		n.top = n.top[:size:size]
+	}
+}
+
+// complete returns the limit most frequent words starting with a prefix.
+func (t *trie) complete(prefix string, limit int) []Suggestion {
+	node := t.root
+	for i := 0; i < len(prefix) && node != nil; i++ {
+		node = node.children[prefix[i]]
+	}
+	if node == nil {
+		return nil
+	}
+	return node.top[:min(limit, len(node.top))]
+}
+
+// sortSuggestions sorts suggestions by descending frequency, then alphabetically.
+func sortSuggestions(suggestions []Suggestion) {
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Frequency != suggestions[j].Frequency {
+			return suggestions[i].Frequency > suggestions[j].Frequency
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+}
+
+// fuzzyMatch is a word of a trie within some edit distance of another word.
+type fuzzyMatch struct {
+	Suggestion
+	distance int
+}
+
+// within returns the words of the trie within a Levenshtein distance of a word, counting the insertion, deletion or
+// substitution of a byte as one edit. The search walks the trie computing one row of the edit distance table per node
+// and leaves a branch as soon as every cell of the row is above the distance, so only a small part of the trie is visited.
+// Words containing a space, which are past queries rather than words, are skipped.
+func (t *trie) within(word string, distance int) []fuzzyMatch {
+	row := make([]int, len(word)+1)
+	for i := range row {
+		row[i] = i
+	}
+	var matches []fuzzyMatch
+	for b, child := range t.root.children {
+		child.within(word, b, row, distance, &matches)
+	}
+	return matches
+}
+
+// within computes the row of the edit distance table for the node reached with byte b, given the row of its parent,
+// and collects the words at or below the node that are within the distance.
+func (n *trieNode) within(word string, b byte, previous []int, distance int, matches *[]fuzzyMatch) {
+	if b == ' ' {
+		return
+	}
+	row := make([]int, len(previous))
+	row[0] = previous[0] + 1
+	best := row[0]
+	for i := 1; i < len(row); i++ {
+		cost := 1
+		if word[i-1] == b {
+			cost = 0
+		}
+		row[i] = min(row[i-1]+1, previous[i]+1, previous[i-1]+cost)
+		best = min(best, row[i])
+	}
+	if n.word != "" && row[len(row)-1] <= distance {
+		*matches = append(*matches, fuzzyMatch{Suggestion{Text: n.word, Frequency: n.frequency}, row[len(row)-1]})
+	}
+	if best > distance {
+		return
+	}
+	for next, child := range n.children {
+		child.within(word, next, row, distance, matches)
+	}
+}
+
+// frequency returns the frequency of a word of the trie, or zero if it is not in the trie.
+func (t *trie) frequency(word string) int {
+	node := t.root
+	for i := 0; i < len(word) && node != nil; i++ {
+		node = node.children[word[i]]
+	}
+	if node == nil {
+		return 0
+	}
+	return node.frequency
+}
@@ -0,0 +1,65 @@
+package views
+
+import (
+	"context"
+	"fiber-search-engine/search"
+	"io"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestSearchResultsView(t *testing.T) {
+	results := []search.Result{{Url: "https://example.com/", Title: "Example", Snippet: "Running <mark>shoes</mark>"}}
+
+	// Define test cases
+	testCases := []struct {
+		query    string
+		page     search.Page
+		message  string
+		selector string
+		expected string
+	}{
+		{"shoes", search.Page{Results: results, Total: 1, Limit: 10}, "", "li a", "Example"},
+		// Snippets are inserted as HTML so the highlight markers are kept
+		{"shoes", search.Page{Results: results, Total: 1, Limit: 10}, "", "li mark", "shoes"},
+		{"shoes", search.Page{Results: results, Total: 11, Limit: 1, NextCursor: "abc"}, "", ".join a", "Next"},
+		{"shoes", search.Page{Results: []search.Result{{Url: "https://example.com/", Similar: 2}}, Total: 1, Limit: 10}, "", "li .badge", "2 similar pages"},
+		{"shoes", search.Page{Results: []search.Result{}, Limit: 10}, "", "p strong", "shoes"},
+		{"shoez", search.Page{Results: []search.Result{}, Limit: 10, DidYouMean: "shoes"}, "", "p a", "shoes"},
+		{"shoes AND", search.Page{}, "expected a search term at position 9", ".alert", "expected a search term at position 9"},
+	}
+
+	// Iterate over test cases
+	for _, tc := range testCases {
+		r, w := io.Pipe()
+		go func() {
+			_ = SearchResults(tc.query, tc.page, tc.message).Render(context.Background(), w)
+			_ = w.Close()
+		}()
+		doc, err := goquery.NewDocumentFromReader(r)
+		if err != nil {
+			t.Fatalf("failed to read template: %v", err)
+		}
+
+		// Compare the result with the expected value
+		if result := doc.Find(tc.selector).First().Text(); result != tc.expected {
+			t.Errorf("Expected '%v', but got '%v'", tc.expected, result)
+		}
+	}
+}
+
+func TestSearchPageView(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		_ = SearchPage("", search.Page{}, "").Render(context.Background(), w)
+		_ = w.Close()
+	}()
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		t.Fatalf("failed to read template: %v", err)
+	}
+	if doc.Find(`input[name="q"][hx-get="/search"]`).Length() == 0 {
+		t.Error("expected the search box to be rendered, but it wasn't")
+	}
+}